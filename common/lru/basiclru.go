@@ -148,6 +148,21 @@ func (c *BasicLRU[K, V]) Keys() []K {
 	return c.list.appendTo(keys)
 }
 
+// Resize changes the capacity of the cache, evicting the least recently used
+// items if the new capacity is below the current item count. It returns the
+// number of evicted items.
+func (c *BasicLRU[K, V]) Resize(capacity int) (evicted int) {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	for c.Len() > capacity {
+		c.RemoveOldest()
+		evicted++
+	}
+	c.cap = capacity
+	return evicted
+}
+
 // list is a doubly-linked list holding items of type he.
 // The zero value is not valid, use newList to create lists.
 type list[T any] struct {
@@ -253,3 +253,42 @@ func BenchmarkLRU(b *testing.B) {
 
 	fmt.Fprintln(io.Discard, sink)
 }
+
+func TestCacheStats(t *testing.T) {
+	cache := NewCache[int, int](2)
+	cache.Add(1, 1)
+	cache.Add(2, 2)
+
+	cache.Get(1)
+	cache.Get(2)
+	cache.Get(3)
+	cache.Peek(3)
+	cache.Contains(3)
+
+	if hits, misses := cache.Stats(); hits != 2 || misses != 1 {
+		t.Fatalf("stats mismatch: have %d/%d, want %d/%d", hits, misses, 2, 1)
+	}
+}
+
+func TestBasicLRUResize(t *testing.T) {
+	cache := NewBasicLRU[int, int](4)
+	for i := 0; i < 4; i++ {
+		cache.Add(i, i)
+	}
+	// Shrinking evicts the least recently used items
+	if evicted := cache.Resize(2); evicted != 2 {
+		t.Fatalf("wrong eviction count: have %d, want %d", evicted, 2)
+	}
+	if cache.Contains(0) || cache.Contains(1) || !cache.Contains(2) || !cache.Contains(3) {
+		t.Fatalf("wrong items retained: %v", cache.Keys())
+	}
+	// Growing retains all items and admits new ones without eviction
+	if evicted := cache.Resize(4); evicted != 0 {
+		t.Fatalf("wrong eviction count: have %d, want %d", evicted, 0)
+	}
+	cache.Add(4, 4)
+	cache.Add(5, 5)
+	if cache.Len() != 4 {
+		t.Fatalf("wrong length: have %d, want %d", cache.Len(), 4)
+	}
+}
@@ -23,6 +23,9 @@ import "sync"
 type Cache[K comparable, V any] struct {
 	cache BasicLRU[K, V]
 	mu    sync.Mutex
+
+	hits   uint64 // Number of successful Get lookups
+	misses uint64 // Number of failed Get lookups
 }
 
 // NewCache creates an LRU cache.
@@ -51,7 +54,13 @@ func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return c.cache.Get(key)
+	value, ok = c.cache.Get(key)
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return value, ok
 }
 
 // Len returns the current number of items in the cache.
@@ -93,3 +102,22 @@ func (c *Cache[K, V]) Keys() []K {
 
 	return c.cache.Keys()
 }
+
+// Resize changes the capacity of the cache, evicting the least recently used
+// items if the new capacity is below the current item count. It returns the
+// number of evicted items.
+func (c *Cache[K, V]) Resize(capacity int) (evicted int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cache.Resize(capacity)
+}
+
+// Stats returns the number of cache hits and misses recorded by Get since the
+// cache was created. Peek and Contains are not accounted.
+func (c *Cache[K, V]) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hits, c.misses
+}
@@ -107,6 +107,10 @@ var (
 	errChainStopped         = errors.New("blockchain is stopped")
 	errInvalidOldChain      = errors.New("invalid old chain")
 	errInvalidNewChain      = errors.New("invalid new chain")
+	errNotPoSA              = errors.New("consensus engine is not PoSA")
+	errNotBlobTx            = errors.New("transaction carries no blobs")
+	errNoFinalizedHeader    = errors.New("finalized header not available")
+	errTxIndexerDisabled    = errors.New("tx indexer is not enabled")
 )
 
 const (
@@ -116,10 +120,18 @@ const (
 	receiptsCacheLimit  = 10000
 	sidecarsCacheLimit  = 1024
 	txLookupCacheLimit  = 1024
+	canonHashCacheLimit = 1024
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
 	maxBeyondBlocks     = 2048
 	prefetchTxNumber    = 100
+	maxBlockRangeQuery  = 10000 // Maximum number of blocks a single range query may cover
+	maxHeaderSegment    = 1024  // Maximum number of headers returned by a single skip query
+	forkHeadsWindow     = 128   // Number of blocks around the head scanned for side-chain heads
+	maxSnapshotAccounts = 4096  // Maximum number of accounts returned by a single snapshot page
+
+	defaultMaxAncestorDepth = 90000 // Default maximum depth of a common ancestor search
+	defaultMaxPinnedBlocks  = 64    // Default maximum number of blocks pinned in memory
 
 	diffLayerFreezerRecheckInterval = 3 * time.Second
 	maxDiffForkDist                 = 11 // Maximum allowed backward distance from the chain head
@@ -236,6 +248,13 @@ type txLookup struct {
 	transaction *types.Transaction
 }
 
+// justifiedBlock is the justified block derived from a particular head header.
+type justifiedBlock struct {
+	head   common.Hash
+	header *types.Header
+	number uint64
+}
+
 // BlockChain represents the canonical chain given a database with a genesis
 // block. The Blockchain manages chain imports, reverts, chain reorganisations.
 //
@@ -265,17 +284,25 @@ type BlockChain struct {
 	triesInMemory uint64
 	txIndexer     *txIndexer // Transaction indexer, might be nil if not enabled
 
+	maxAncestorDepth atomic.Uint64 // Maximum number of blocks walked back when searching for a common ancestor
+
 	hc                       *HeaderChain
 	rmLogsFeed               event.Feed
+	reorgFeed                event.Feed
 	chainFeed                event.Feed
 	chainHeadFeed            event.Feed
 	chainBlockFeed           event.Feed
 	logsFeed                 event.Feed
+	sidecarsFeed             event.Feed
 	blockProcFeed            event.Feed
+	blockProcErrFeed         event.Feed
 	finalizedHeaderFeed      event.Feed
+	safeHeaderFeed           event.Feed
+	prunedFeed               event.Feed
 	highestVerifiedBlockFeed event.Feed
 	scope                    event.SubscriptionScope
 	genesisBlock             *types.Block
+	genesisHash              common.Hash
 
 	// This mutex synchronizes chain write operations.
 	// Readers don't need to take it, they can just read the database.
@@ -287,15 +314,28 @@ type BlockChain struct {
 	currentSnapBlock      atomic.Pointer[types.Header] // Current head of snap-sync
 	currentFinalBlock     atomic.Pointer[types.Header] // Latest (consensus) finalized block
 	chasingHead           atomic.Pointer[types.Header]
+	currentJustified      atomic.Pointer[justifiedBlock] // Justified block of the last queried head
+	prefetchedRoot        atomic.Pointer[common.Hash]    // Head state root last warmed by PrefetchHeadState
+	lastSafeHeader        atomic.Pointer[types.Header]   // Safe (justified) header last announced via safeHeaderFeed
+
+	bodyCache        *lru.Cache[common.Hash, *types.Body]
+	bodyRLPCache     *lru.Cache[common.Hash, rlp.RawValue]
+	receiptsCache    *lru.Cache[common.Hash, []*types.Receipt]
+	receiptsRLPCache *lru.Cache[common.Hash, rlp.RawValue]
+	blockCache       *lru.Cache[common.Hash, *types.Block]
+
+	canonHashLock  sync.Mutex
+	canonHashGen   uint64                          // Bumped on every canonical mapping change to discard racing cache fills
+	canonHashCache *lru.Cache[uint64, common.Hash] // Canonical number->hash mappings, invalidated on head changes
 
-	bodyCache     *lru.Cache[common.Hash, *types.Body]
-	bodyRLPCache  *lru.Cache[common.Hash, rlp.RawValue]
-	receiptsCache *lru.Cache[common.Hash, []*types.Receipt]
-	blockCache    *lru.Cache[common.Hash, *types.Block]
+	pinnedLock      sync.RWMutex
+	pinnedBlocks    map[common.Hash]*types.Block // Blocks kept resident regardless of blockCache evictions
+	maxPinnedBlocks int                          // Maximum number of blocks that may be pinned
 
-	txLookupLock  sync.RWMutex
-	txLookupCache *lru.Cache[common.Hash, txLookup]
-	sidecarsCache *lru.Cache[common.Hash, types.BlobSidecars]
+	txLookupLock     sync.RWMutex
+	txLookupCache    *lru.Cache[common.Hash, txLookup]
+	sidecarsCache    *lru.Cache[common.Hash, types.BlobSidecars]
+	sidecarsRLPCache *lru.Cache[common.Hash, rlp.RawValue]
 
 	// future blocks are blocks added for later processing
 	futureBlocks *lru.Cache[common.Hash, *types.Block]
@@ -381,8 +421,13 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 		bodyCache:          lru.NewCache[common.Hash, *types.Body](bodyCacheLimit),
 		bodyRLPCache:       lru.NewCache[common.Hash, rlp.RawValue](bodyCacheLimit),
 		receiptsCache:      lru.NewCache[common.Hash, []*types.Receipt](receiptsCacheLimit),
+		receiptsRLPCache:   lru.NewCache[common.Hash, rlp.RawValue](blockCacheLimit),
 		sidecarsCache:      lru.NewCache[common.Hash, types.BlobSidecars](sidecarsCacheLimit),
+		sidecarsRLPCache:   lru.NewCache[common.Hash, rlp.RawValue](blockCacheLimit),
 		blockCache:         lru.NewCache[common.Hash, *types.Block](blockCacheLimit),
+		canonHashCache:     lru.NewCache[uint64, common.Hash](canonHashCacheLimit),
+		pinnedBlocks:       make(map[common.Hash]*types.Block),
+		maxPinnedBlocks:    defaultMaxPinnedBlocks,
 		txLookupCache:      lru.NewCache[common.Hash, txLookup](txLookupCacheLimit),
 		futureBlocks:       lru.NewCache[common.Hash, *types.Block](maxFutureBlocks),
 		diffLayerCache:     diffLayerCache,
@@ -398,6 +443,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 		return nil, err
 	}
 	bc.flushInterval.Store(int64(cacheConfig.TrieTimeLimit))
+	bc.maxAncestorDepth.Store(defaultMaxAncestorDepth)
 	bc.forker = NewForkChoice(bc, shouldPreserve)
 	bc.statedb = state.NewDatabase(bc.triedb, nil)
 	bc.validator = NewBlockValidator(chainConfig, bc)
@@ -408,6 +454,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 	if bc.genesisBlock == nil {
 		return nil, ErrNoGenesis
 	}
+	bc.genesisHash = bc.genesisBlock.Hash()
 
 	bc.highestVerifiedHeader.Store(nil)
 	bc.highestVerifiedBlock.Store(nil)
@@ -565,6 +612,13 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, genesis *Genesis
 	bc.wg.Add(1)
 	go bc.updateFutureBlocks()
 
+	// Announce the blocks moved out of the key-value store by the freezer
+	frozenCh := make(chan rawdb.FrozenEvent)
+	if sub := rawdb.SubscribeFrozenEvent(bc.db.BlockStore(), frozenCh); sub != nil {
+		bc.wg.Add(1)
+		go bc.prunedBlocksLoop(frozenCh, sub)
+	}
+
 	// Need persist and prune diff layer
 	if bc.db.DiffStore() != nil {
 		bc.wg.Add(1)
@@ -1138,15 +1192,24 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, time uint64, root common.Ha
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
 	bc.receiptsCache.Purge()
+	bc.receiptsRLPCache.Purge()
 	bc.sidecarsCache.Purge()
+	bc.sidecarsRLPCache.Purge()
 	bc.blockCache.Purge()
+	bc.purgeCanonHashes()
 	bc.txLookupCache.Purge()
 	bc.futureBlocks.Purge()
 
+	bc.pinnedLock.Lock()
+	clear(bc.pinnedBlocks)
+	bc.pinnedLock.Unlock()
+
 	if finalized := bc.CurrentFinalBlock(); finalized != nil && head < finalized.Number.Uint64() {
 		log.Error("SetHead invalidated finalized block")
 		bc.SetFinalized(nil)
 	}
+	// Forget the announced safe header, so the rewound chain announces its own
+	bc.lastSafeHeader.Store(nil)
 
 	return rootNumber, bc.loadLastState()
 }
@@ -1174,6 +1237,7 @@ func (bc *BlockChain) SnapSyncCommitHead(hash common.Hash) error {
 		return errChainStopped
 	}
 	bc.currentBlock.Store(block.Header())
+	bc.currentJustified.Store(nil)
 	headBlockGauge.Update(int64(block.NumberU64()))
 	justifiedBlockGauge.Update(int64(bc.GetJustifiedNumber(block.Header())))
 	finalizedBlockGauge.Update(int64(bc.getFinalizedNumber(block.Header())))
@@ -1226,6 +1290,7 @@ func (bc *BlockChain) ResetWithGenesisBlock(genesis *types.Block) error {
 
 	// Last update all in-memory chain markers
 	bc.genesisBlock = genesis
+	bc.genesisHash = genesis.Hash()
 	bc.currentBlock.Store(bc.genesisBlock.Header())
 	headBlockGauge.Update(int64(bc.genesisBlock.NumberU64()))
 	justifiedBlockGauge.Update(int64(bc.genesisBlock.NumberU64()))
@@ -1295,6 +1360,7 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 		if err := blockBatch.Write(); err != nil {
 			log.Crit("Failed to update chain indexes and markers in block db", "err", err)
 		}
+		bc.cacheCanonHash(block.NumberU64(), block.Hash())
 	}()
 	go func() {
 		defer bc.dbWg.Done()
@@ -1320,6 +1386,26 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	finalizedBlockGauge.Update(int64(bc.getFinalizedNumber(block.Header())))
 }
 
+// cacheCanonHash records a canonical number->hash mapping that was just written
+// to the database, discarding any cache fill that raced with the write.
+func (bc *BlockChain) cacheCanonHash(number uint64, hash common.Hash) {
+	bc.canonHashLock.Lock()
+	defer bc.canonHashLock.Unlock()
+
+	bc.canonHashGen++
+	bc.canonHashCache.Add(number, hash)
+}
+
+// purgeCanonHashes drops all cached canonical number->hash mappings after the
+// canonical chain was rewritten, discarding any cache fill that raced with it.
+func (bc *BlockChain) purgeCanonHashes() {
+	bc.canonHashLock.Lock()
+	defer bc.canonHashLock.Unlock()
+
+	bc.canonHashGen++
+	bc.canonHashCache.Purge()
+}
+
 // stopWithoutSaving stops the blockchain service. If any imports are currently in progress
 // it will abort them using the procInterrupt. This method stops all running
 // goroutines, but does not do all the post-stop work of persisting data.
@@ -1615,6 +1701,7 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 		if err := blockBatch.Write(); err != nil {
 			return 0, err
 		}
+		bc.purgeCanonHashes()
 		stats.processed += int32(len(blockChain))
 		return 0, nil
 	}
@@ -1948,13 +2035,19 @@ func (bc *BlockChain) writeBlockAndSetHead(block *types.Block, receipts []*types
 		if len(logs) > 0 {
 			bc.logsFeed.Send(logs)
 		}
+		// The sidecars were persisted by writeBlockWithState, announce them now
+		// that the block made it into the canonical chain.
+		if sidecars := block.Sidecars(); len(sidecars) > 0 && bc.chainConfig.IsCancun(block.Number(), block.Time()) {
+			bc.sidecarsFeed.Send(SidecarsEvent{Hash: block.Hash(), Number: block.NumberU64(), Sidecars: sidecars})
+		}
 		// In theory, we should fire a ChainHeadEvent when we inject
 		// a canonical block, but sometimes we can insert a batch of
 		// canonical blocks. Avoid firing too many ChainHeadEvents,
 		// we will fire an accumulated ChainHeadEvent and disable fire
 		// event here.
 		var finalizedHeader *types.Header
-		if posa, ok := bc.Engine().(consensus.PoSA); ok {
+		posa, isPoSA := bc.Engine().(consensus.PoSA)
+		if isPoSA {
 			if finalizedHeader = posa.GetFinalizedHeader(bc, block.Header()); finalizedHeader != nil {
 				bc.SetFinalized(finalizedHeader)
 			}
@@ -1964,11 +2057,32 @@ func (bc *BlockChain) writeBlockAndSetHead(block *types.Block, receipts []*types
 			if finalizedHeader != nil {
 				bc.finalizedHeaderFeed.Send(FinalizedHeaderEvent{finalizedHeader})
 			}
+			if isPoSA {
+				bc.sendSafeHeaderEvent(posa, block.Header())
+			}
 		}
 	}
 	return status, nil
 }
 
+// sendSafeHeaderEvent announces the safe (justified) header of the given head
+// if it advanced past the last announced one.
+func (bc *BlockChain) sendSafeHeaderEvent(posa consensus.PoSA, head *types.Header) {
+	number, hash, err := posa.GetJustifiedNumberAndHash(bc, []*types.Header{head})
+	if err != nil {
+		return
+	}
+	if last := bc.lastSafeHeader.Load(); last != nil && last.Number.Uint64() >= number {
+		return
+	}
+	header := bc.GetHeaderByHash(hash)
+	if header == nil {
+		return
+	}
+	bc.lastSafeHeader.Store(header)
+	bc.safeHeaderFeed.Send(SafeHeaderEvent{header})
+}
+
 // addFutureBlock checks if the block is within the max allowed window to get
 // accepted for future processing, and returns an error if the block is too far
 // ahead and was not added.
@@ -2058,6 +2172,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, setHead bool, makeWitness
 				if finalizedHeader := posa.GetFinalizedHeader(bc, lastCanon.Header()); finalizedHeader != nil {
 					bc.finalizedHeaderFeed.Send(FinalizedHeaderEvent{finalizedHeader})
 				}
+				bc.sendSafeHeaderEvent(posa, lastCanon.Header())
 			}
 		}
 	}()
@@ -2710,6 +2825,8 @@ func (bc *BlockChain) reorg(oldHead *types.Header, newHead *types.Header) error
 		newChain    []*types.Header
 		oldChain    []*types.Header
 		commonBlock *types.Header
+
+		oldTip, newTip = oldHead, newHead
 	)
 	// Reduce the longer chain to the same number as the shorter one
 	if oldHead.Number.Uint64() > newHead.Number.Uint64() {
@@ -2809,6 +2926,9 @@ func (bc *BlockChain) reorg(oldHead *types.Header, newHead *types.Header) error
 		if len(deletedLogs) > 0 {
 			bc.rmLogsFeed.Send(RemovedLogsEvent{deletedLogs})
 		}
+		if len(oldChain) > 0 {
+			bc.reorgFeed.Send(ReorgEvent{OldHead: oldTip, NewHead: newTip, CommonAncestor: commonBlock})
+		}
 	}
 	// Undo old blocks in reverse order
 	for i := 0; i < len(oldChain); i++ {
@@ -2881,6 +3001,8 @@ func (bc *BlockChain) reorg(oldHead *types.Header, newHead *types.Header) error
 	if err := blockBatch.Write(); err != nil {
 		log.Crit("Failed to delete useless indexes use block batch", "err", err)
 	}
+	bc.purgeCanonHashes()
+
 	// Reset the tx lookup cache to clear stale txlookup cache.
 	bc.txLookupCache.Purge()
 
@@ -2965,6 +3087,24 @@ func (bc *BlockChain) updateFutureBlocks() {
 	}
 }
 
+// prunedBlocksLoop relays the blocks moved out of the key-value store by the
+// database freezer as PrunedEvent.
+func (bc *BlockChain) prunedBlocksLoop(frozenCh <-chan rawdb.FrozenEvent, sub event.Subscription) {
+	defer bc.wg.Done()
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-frozenCh:
+			bc.prunedFeed.Send(PrunedEvent{From: ev.From, To: ev.To})
+		case <-sub.Err():
+			return
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
 func (bc *BlockChain) trustedDiffLayerLoop() {
 	recheck := time.NewTicker(diffLayerFreezerRecheckInterval)
 	defer func() {
@@ -3111,6 +3251,7 @@ func (bc *BlockChain) reportBlock(block *types.Block, res *ProcessResult, err er
 	}
 	rawdb.WriteBadBlock(bc.db, block)
 	log.Error(summarizeBadBlock(block, receipts, bc.Config(), err))
+	bc.blockProcErrFeed.Send(BlockProcessingError{Hash: block.Hash(), Number: block.NumberU64(), Err: err})
 }
 
 // summarizeBadBlock returns a string summarizing the bad block and other
@@ -3162,6 +3303,9 @@ func (bc *BlockChain) InsertHeaderChain(chain []*types.Header) (int, error) {
 	}
 	defer bc.chainmu.Unlock()
 	_, err := bc.hc.InsertHeaderChain(chain, start, bc.forker)
+
+	// The header chain might have reorganised the canonical number mappings
+	bc.purgeCanonHashes()
 	return 0, err
 }
 
@@ -3318,6 +3462,21 @@ func (bc *BlockChain) SetTrieFlushInterval(interval time.Duration) {
 	bc.flushInterval.Store(int64(interval))
 }
 
+// SetMaxAncestorDepth configures the maximum number of blocks FindCommonAncestor
+// walks back on either chain before giving up. It is thread-safe.
+func (bc *BlockChain) SetMaxAncestorDepth(depth uint64) {
+	bc.maxAncestorDepth.Store(depth)
+}
+
+// SetMaxPinnedBlocks configures the maximum number of blocks that may be pinned
+// in memory. Already pinned blocks are retained even if they exceed the limit.
+func (bc *BlockChain) SetMaxPinnedBlocks(limit int) {
+	bc.pinnedLock.Lock()
+	defer bc.pinnedLock.Unlock()
+
+	bc.maxPinnedBlocks = limit
+}
+
 // GetTrieFlushInterval gets the in-memory tries flushAlloc interval
 func (bc *BlockChain) GetTrieFlushInterval() time.Duration {
 	return time.Duration(bc.flushInterval.Load())
@@ -17,21 +17,35 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"math"
 	"math/big"
+	"runtime"
+	"slices"
+	"time"
 
 	"github.com/ethereum/go-ethereum/log"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
 	"github.com/ethereum/go-ethereum/triedb"
+	"golang.org/x/sync/errgroup"
 )
 
 // CurrentHeader retrieves the current head header of the canonical chain. The
@@ -66,6 +80,24 @@ func (bc *BlockChain) CurrentFinalBlock() *types.Header {
 	return nil
 }
 
+// CurrentFinalizedBlock retrieves the full block of the current finalized
+// header, as resolved by the PoSA engine for the current head. An error is
+// returned if the engine is not PoSA or finality is not available.
+func (bc *BlockChain) CurrentFinalizedBlock() (*types.Block, error) {
+	if _, ok := bc.engine.(consensus.PoSA); !ok {
+		return nil, errNotPoSA
+	}
+	header := bc.CurrentFinalBlock()
+	if header == nil {
+		return nil, errNoFinalizedHeader
+	}
+	block := bc.GetBlock(header.Hash(), header.Number.Uint64())
+	if block == nil {
+		return nil, fmt.Errorf("finalized block #%d [%x..] not found", header.Number, header.Hash().Bytes()[:4])
+	}
+	return block, nil
+}
+
 // CurrentSafeBlock retrieves the current safe block of the canonical
 // chain. The block is retrieved from the blockchain's internal cache.
 func (bc *BlockChain) CurrentSafeBlock() *types.Header {
@@ -82,12 +114,151 @@ func (bc *BlockChain) CurrentSafeBlock() *types.Header {
 	return nil
 }
 
+// FinalityLag returns the number of blocks the current finalized block trails
+// the current head header.
+func (bc *BlockChain) FinalityLag() (uint64, error) {
+	p, ok := bc.engine.(consensus.PoSA)
+	if !ok {
+		return 0, errNotPoSA
+	}
+	currentHeader := bc.CurrentHeader()
+	if currentHeader == nil {
+		return 0, ErrCurrentBlockNotFound
+	}
+	finalized := p.GetFinalizedHeader(bc, currentHeader)
+	if finalized == nil {
+		return 0, errNoFinalizedHeader
+	}
+	head, final := currentHeader.Number.Uint64(), finalized.Number.Uint64()
+	if head < final {
+		return 0, nil
+	}
+	return head - final, nil
+}
+
+// CurrentJustifiedBlock retrieves the current justified block of the canonical
+// chain along with its number. The result is cached until the head changes.
+func (bc *BlockChain) CurrentJustifiedBlock() (*types.Header, uint64) {
+	p, ok := bc.engine.(consensus.PoSA)
+	if !ok {
+		return nil, 0
+	}
+	currentHeader := bc.CurrentHeader()
+	if currentHeader == nil {
+		return nil, 0
+	}
+	head := currentHeader.Hash()
+	if cached := bc.currentJustified.Load(); cached != nil && cached.head == head {
+		return cached.header, cached.number
+	}
+	justifiedBlockNumber, justifiedBlockHash, err := p.GetJustifiedNumberAndHash(bc, []*types.Header{currentHeader})
+	if err != nil {
+		return nil, 0
+	}
+	header := bc.GetHeaderByHash(justifiedBlockHash)
+	if header == nil {
+		return nil, 0
+	}
+	bc.currentJustified.Store(&justifiedBlock{head: head, header: header, number: justifiedBlockNumber})
+	return header, justifiedBlockNumber
+}
+
+// FinalityView is a consistent snapshot of the chain head along with its safe
+// (justified) and finalized blocks, as derived from the same head header.
+type FinalityView struct {
+	HeadNumber uint64
+	HeadHash   common.Hash
+
+	SafeNumber uint64
+	SafeHash   common.Hash
+
+	FinalizedNumber uint64
+	FinalizedHash   common.Hash
+
+	SafeLag      uint64 // Number of blocks the safe block trails the head
+	FinalizedLag uint64 // Number of blocks the finalized block trails the head
+}
+
+// FinalityView retrieves the head, safe and finalized blocks of the canonical
+// chain in one go. All values are computed from a single head header, so they
+// are consistent with each other even if the chain advances meanwhile.
+func (bc *BlockChain) FinalityView() (*FinalityView, error) {
+	p, ok := bc.engine.(consensus.PoSA)
+	if !ok {
+		return nil, errNotPoSA
+	}
+	head := bc.CurrentHeader()
+	if head == nil {
+		return nil, ErrCurrentBlockNotFound
+	}
+	safeNumber, safeHash, err := p.GetJustifiedNumberAndHash(bc, []*types.Header{head})
+	if err != nil {
+		return nil, err
+	}
+	finalized := p.GetFinalizedHeader(bc, head)
+	if finalized == nil {
+		return nil, errNoFinalizedHeader
+	}
+	view := &FinalityView{
+		HeadNumber:      head.Number.Uint64(),
+		HeadHash:        head.Hash(),
+		SafeNumber:      safeNumber,
+		SafeHash:        safeHash,
+		FinalizedNumber: finalized.Number.Uint64(),
+		FinalizedHash:   finalized.Hash(),
+	}
+	if view.HeadNumber > view.SafeNumber {
+		view.SafeLag = view.HeadNumber - view.SafeNumber
+	}
+	if view.HeadNumber > view.FinalizedNumber {
+		view.FinalizedLag = view.HeadNumber - view.FinalizedNumber
+	}
+	return view, nil
+}
+
+// ChainHealthReport summarizes the liveness of the local chain.
+type ChainHealthReport struct {
+	HeadNumber    uint64
+	HeadTime      uint64 // Timestamp of the head header
+	HeadAge       uint64 // Seconds elapsed since the head timestamp
+	FinalityLag   uint64 // Number of blocks the finalized block trails the head, zero if unknown
+	TxIndexSynced bool   // Whether the transaction indexer caught up, false if disabled
+}
+
+// ChainHealth assembles a ChainHealthReport. The head related fields are
+// all derived from a single head header.
+func (bc *BlockChain) ChainHealth() ChainHealthReport {
+	head := bc.CurrentHeader()
+	report := ChainHealthReport{
+		HeadNumber: head.Number.Uint64(),
+		HeadTime:   head.Time,
+	}
+	if now := uint64(time.Now().Unix()); now > head.Time {
+		report.HeadAge = now - head.Time
+	}
+	if p, ok := bc.engine.(consensus.PoSA); ok {
+		if finalized := p.GetFinalizedHeader(bc, head); finalized != nil && report.HeadNumber > finalized.Number.Uint64() {
+			report.FinalityLag = report.HeadNumber - finalized.Number.Uint64()
+		}
+	}
+	if progress, err := bc.TxIndexProgress(); err == nil {
+		report.TxIndexSynced = progress.Done()
+	}
+	return report
+}
+
 // HasHeader checks if a block header is present in the database or not, caching
 // it if present.
 func (bc *BlockChain) HasHeader(hash common.Hash, number uint64) bool {
 	return bc.hc.HasHeader(hash, number)
 }
 
+// GetBlockNumber retrieves the block number belonging to the given hash from
+// the cache or database. Nil is returned if the block is unknown.
+func (bc *BlockChain) GetBlockNumber(hash common.Hash) *uint64 {
+	return bc.hc.GetBlockNumber(hash)
+}
+
 // GetHeader retrieves a block header from the database by hash and number,
 // caching it if found.
 func (bc *BlockChain) GetHeader(hash common.Hash, number uint64) *types.Header {
@@ -109,10 +280,167 @@ func (bc *BlockChain) GetVerifiedBlockByHash(hash common.Hash) *types.Header {
 	return bc.hc.GetHeaderByHash(hash)
 }
 
+// HighestVerifiedHeader retrieves the header of the highest block that has been
+// fully verified and is about to become the canonical head, which may be only
+// in memory. Nil is returned if no block has been verified since startup.
+// Updates are announced through SubscribeHighestVerifiedHeaderEvent.
+func (bc *BlockChain) HighestVerifiedHeader() *types.Header {
+	return bc.highestVerifiedBlock.Load()
+}
+
 // GetHeaderByNumber retrieves a block header from the database by number,
 // caching it (associated with its hash) if found.
 func (bc *BlockChain) GetHeaderByNumber(number uint64) *types.Header {
-	return bc.hc.GetHeaderByNumber(number)
+	hash := bc.canonicalHash(number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return bc.GetHeader(hash, number)
+}
+
+// GetHeaderByHashOrNumber retrieves a block header either by hash or by canonical
+// number, depending on useHash. The other argument is ignored.
+func (bc *BlockChain) GetHeaderByHashOrNumber(hash common.Hash, number uint64, useHash bool) *types.Header {
+	if useHash {
+		return bc.GetHeaderByHash(hash)
+	}
+	return bc.GetHeaderByNumber(number)
+}
+
+// GetBlockByTimestamp retrieves the last canonical header whose timestamp is not
+// after the given one, using a binary search between genesis and the current
+// head. If the timestamp precedes genesis, the genesis header is returned; if
+// it exceeds the head, the head header is returned.
+//
+// The search assumes that timestamps are monotonically non-decreasing along the
+// chain, which the consensus rules enforce.
+func (bc *BlockChain) GetBlockByTimestamp(ts uint64) (*types.Header, error) {
+	head := bc.CurrentBlock()
+	if ts >= head.Time {
+		return head, nil
+	}
+	genesis := bc.genesisBlock.Header()
+	if ts < genesis.Time {
+		return genesis, nil
+	}
+	// Invariant: header(lo).Time <= ts < header(hi).Time
+	var (
+		lo     = uint64(0)
+		hi     = head.Number.Uint64()
+		header = genesis
+	)
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		h := bc.GetHeaderByNumber(mid)
+		if h == nil {
+			return nil, fmt.Errorf("canonical header #%d not found", mid)
+		}
+		if h.Time <= ts {
+			lo, header = mid, h
+		} else {
+			hi = mid
+		}
+	}
+	return header, nil
+}
+
+// BlockFeeInfo retrieves the gas used, the gas limit and the base fee of the
+// canonical block with the given number. Only the header is loaded, the body is
+// never touched. The base fee is nil for pre-London blocks.
+func (bc *BlockChain) BlockFeeInfo(number uint64) (gasUsed, gasLimit uint64, baseFee *big.Int, err error) {
+	header := bc.GetHeaderByNumber(number)
+	if header == nil {
+		return 0, 0, nil, fmt.Errorf("block #%d not found", number)
+	}
+	if header.BaseFee != nil {
+		baseFee = new(big.Int).Set(header.BaseFee)
+	}
+	return header.GasUsed, header.GasLimit, baseFee, nil
+}
+
+// BlockRewards computes the effective priority fees paid in the canonical block
+// with the given number at the requested percentiles, which must be ascending
+// and within [0, 100]. Like the fee history API, the transactions are sorted by
+// their effective tip and weighted by the gas they used. Zero tips are returned
+// for empty blocks.
+func (bc *BlockChain) BlockRewards(number uint64, percentiles []float64) ([]*big.Int, error) {
+	for i, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("invalid reward percentile: %f", p)
+		}
+		if i > 0 && p <= percentiles[i-1] {
+			return nil, fmt.Errorf("invalid reward percentile: #%d:%f >= #%d:%f", i-1, percentiles[i-1], i, p)
+		}
+	}
+	block := bc.GetBlockByNumber(number)
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	rewards := make([]*big.Int, len(percentiles))
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		for i := range rewards {
+			rewards[i] = new(big.Int)
+		}
+		return rewards, nil
+	}
+	hash := block.Hash()
+	receipts := bc.GetReceiptsByHash(hash)
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("receipts #%d [%x..] not found", number, hash[:4])
+	}
+	type txReward struct {
+		gasUsed uint64
+		reward  *big.Int
+	}
+	sorter := make([]txReward, len(txs))
+	for i, tx := range txs {
+		reward, _ := tx.EffectiveGasTip(block.BaseFee())
+		sorter[i] = txReward{gasUsed: receipts[i].GasUsed, reward: reward}
+	}
+	slices.SortStableFunc(sorter, func(a, b txReward) int {
+		return a.reward.Cmp(b.reward)
+	})
+	var (
+		txIndex    int
+		sumGasUsed = sorter[0].gasUsed
+	)
+	for i, p := range percentiles {
+		threshold := uint64(float64(block.GasUsed()) * p / 100)
+		for sumGasUsed < threshold && txIndex < len(txs)-1 {
+			txIndex++
+			sumGasUsed += sorter[txIndex].gasUsed
+		}
+		rewards[i] = sorter[txIndex].reward
+	}
+	return rewards, nil
+}
+
+// GetDifficulty retrieves the difficulty stored in the header of the block with
+// the given hash. Under Parlia this encodes whether the block was sealed in-turn
+// or out-of-turn. The returned value is a copy and is safe to modify.
+func (bc *BlockChain) GetDifficulty(hash common.Hash) (*big.Int, error) {
+	header := bc.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, fmt.Errorf("header %x not found", hash)
+	}
+	if header.Difficulty == nil {
+		return new(big.Int), nil
+	}
+	return new(big.Int).Set(header.Difficulty), nil
+}
+
+var diffInTurn = big.NewInt(2) // Block difficulty for in-turn signatures
+
+// WasInTurn reports whether the block with the given hash was sealed in-turn,
+// based on the difficulty stored in its header. The result is only meaningful
+// for blocks sealed by Parlia.
+func (bc *BlockChain) WasInTurn(hash common.Hash) (bool, error) {
+	difficulty, err := bc.GetDifficulty(hash)
+	if err != nil {
+		return false, err
+	}
+	return difficulty.Cmp(diffInTurn) == 0, nil
 }
 
 // GetHeadersFrom returns a contiguous segment of headers, in rlp-form, going
@@ -121,6 +449,108 @@ func (bc *BlockChain) GetHeadersFrom(number, count uint64) []rlp.RawValue {
 	return bc.hc.GetHeadersFrom(number, count)
 }
 
+// GetHeaderRange retrieves the decoded canonical headers in the range [from, to]
+// in ascending order, served from the header chain's cache where possible. The
+// range is truncated at the current chain head.
+//
+// The returned headers are shared with the cache, callers must not mutate them.
+func (bc *BlockChain) GetHeaderRange(from, to uint64) ([]*types.Header, error) {
+	if to < from {
+		return nil, fmt.Errorf("invalid header range: from %d > to %d", from, to)
+	}
+	head := bc.CurrentHeader().Number.Uint64()
+	if from > head {
+		return nil, nil
+	}
+	if to > head {
+		to = head
+	}
+	if to-from >= maxBlockRangeQuery {
+		return nil, fmt.Errorf("header range too large: %d > %d", to-from+1, maxBlockRangeQuery)
+	}
+	headers := make([]*types.Header, 0, to-from+1)
+	for number := from; number <= to; number++ {
+		hash := bc.hc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			return nil, fmt.Errorf("canonical hash #%d not found", number)
+		}
+		header := bc.hc.GetHeader(hash, number)
+		if header == nil {
+			return nil, fmt.Errorf("canonical header #%d [%x..] not found", number, hash[:4])
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// IterateHeaders invokes fn for each canonical header in ascending order,
+// starting at the given number. The iteration stops when fn returns false or
+// the end of the canonical chain is reached. Only headers are loaded, served
+// from the header chain's cache where possible.
+//
+// The yielded headers are shared with the cache, callers must not mutate them.
+func (bc *BlockChain) IterateHeaders(start uint64, fn func(*types.Header) bool) error {
+	for number := start; ; number++ {
+		hash := bc.hc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			return nil
+		}
+		header := bc.hc.GetHeader(hash, number)
+		if header == nil {
+			return fmt.Errorf("canonical header #%d [%x..] not found", number, hash[:4])
+		}
+		if !fn(header) {
+			return nil
+		}
+	}
+}
+
+// GetHeadersWithSkip returns a segment of canonical headers, in rlp-form,
+// starting at the given number and leaving skip headers between consecutive
+// ones, going backwards if reverse is set or forwards otherwise. The count is
+// capped to maxHeaderSegment and the segment ends early at the chain head or
+// genesis.
+func (bc *BlockChain) GetHeadersWithSkip(number, count, skip uint64, reverse bool) []rlp.RawValue {
+	if skip == math.MaxUint64 {
+		return nil
+	}
+	if count > maxHeaderSegment {
+		count = maxHeaderSegment
+	}
+	if skip == 0 && reverse {
+		return bc.GetHeadersFrom(number, count)
+	}
+	var (
+		headers []rlp.RawValue
+		step    = skip + 1
+		head    = bc.CurrentHeader().Number.Uint64()
+	)
+	for ; count > 0 && number <= head; count-- {
+		hash := bc.hc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			break
+		}
+		data := rawdb.ReadHeaderRLP(bc.db, hash, number)
+		if len(data) == 0 {
+			break
+		}
+		headers = append(headers, data)
+
+		if reverse {
+			if number < step {
+				break
+			}
+			number -= step
+		} else {
+			if number > math.MaxUint64-step {
+				break
+			}
+			number += step
+		}
+	}
+	return headers
+}
+
 // GetBody retrieves a block body (transactions and uncles) from the database by
 // hash, caching it if found.
 func (bc *BlockChain) GetBody(hash common.Hash) *types.Body {
@@ -128,6 +558,17 @@ func (bc *BlockChain) GetBody(hash common.Hash) *types.Body {
 	if cached, ok := bc.bodyCache.Get(hash); ok {
 		return cached
 	}
+	// If the full block is cached, reconstruct the body from it. The slices are
+	// copied so that callers modifying the body don't corrupt the cached block.
+	if block, ok := bc.blockCache.Get(hash); ok {
+		body := &types.Body{
+			Transactions: slices.Clone(block.Transactions()),
+			Uncles:       slices.Clone(block.Uncles()),
+			Withdrawals:  slices.Clone(block.Withdrawals()),
+		}
+		bc.bodyCache.Add(hash, body)
+		return body
+	}
 	number := bc.hc.GetBlockNumber(hash)
 	if number == nil {
 		return nil
@@ -141,6 +582,88 @@ func (bc *BlockChain) GetBody(hash common.Hash) *types.Body {
 	return body
 }
 
+// GetBodyByNumber retrieves the body of the canonical block with the given
+// number, caching it if found.
+func (bc *BlockChain) GetBodyByNumber(number uint64) (*types.Body, error) {
+	hash := bc.GetCanonicalHash(number)
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	body := bc.GetBody(hash)
+	if body == nil {
+		return nil, fmt.Errorf("block body #%d [%x..] not found", number, hash[:4])
+	}
+	return body, nil
+}
+
+// BlockTxCount retrieves the number of transactions included in the block with
+// the given hash. Cached bodies and blocks are used if available, otherwise only
+// the outer structure of the body RLP is parsed, the transactions themselves are
+// not decoded.
+func (bc *BlockChain) BlockTxCount(hash common.Hash) (int, error) {
+	if body, ok := bc.bodyCache.Get(hash); ok {
+		return len(body.Transactions), nil
+	}
+	if block, ok := bc.blockCache.Get(hash); ok {
+		return len(block.Transactions()), nil
+	}
+	body := bc.GetBodyRLP(hash)
+	if len(body) == 0 {
+		return 0, fmt.Errorf("block %x not found", hash)
+	}
+	// The body is a list whose first element is the list of transactions
+	fields, _, err := rlp.SplitList(body)
+	if err != nil {
+		return 0, fmt.Errorf("invalid body %x: %v", hash, err)
+	}
+	txs, _, err := rlp.SplitList(fields)
+	if err != nil {
+		return 0, fmt.Errorf("invalid transactions of body %x: %v", hash, err)
+	}
+	return rlp.CountValues(txs)
+}
+
+// GetTransactions retrieves the transactions included in the block with the
+// given hash. Cached bodies and blocks are used if available, otherwise only the
+// transaction list of the body RLP is decoded, leaving the uncles and
+// withdrawals untouched.
+func (bc *BlockChain) GetTransactions(hash common.Hash) (types.Transactions, error) {
+	if body, ok := bc.bodyCache.Get(hash); ok {
+		return slices.Clone(body.Transactions), nil
+	}
+	if block, ok := bc.blockCache.Get(hash); ok {
+		return slices.Clone(block.Transactions()), nil
+	}
+	body := bc.GetBodyRLP(hash)
+	if len(body) == 0 {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	// The body is a list whose first element is the list of transactions
+	stream := rlp.NewStream(bytes.NewReader(body), uint64(len(body)))
+	if _, err := stream.List(); err != nil {
+		return nil, fmt.Errorf("invalid body %x: %v", hash, err)
+	}
+	var txs types.Transactions
+	if err := stream.Decode(&txs); err != nil {
+		return nil, fmt.Errorf("invalid transactions of body %x: %v", hash, err)
+	}
+	return txs, nil
+}
+
+// GetTxHashes retrieves the hashes of all transactions included in the block
+// with the given hash. The body is served from the cache if available.
+func (bc *BlockChain) GetTxHashes(hash common.Hash) ([]common.Hash, error) {
+	body := bc.GetBody(hash)
+	if body == nil {
+		return nil, fmt.Errorf("block body %x not found", hash)
+	}
+	hashes := make([]common.Hash, len(body.Transactions))
+	for i, tx := range body.Transactions {
+		hashes[i] = tx.Hash()
+	}
+	return hashes, nil
+}
+
 // GetBodyRLP retrieves a block body in RLP encoding from the database by hash,
 // caching it if found.
 func (bc *BlockChain) GetBodyRLP(hash common.Hash) rlp.RawValue {
@@ -161,6 +684,26 @@ func (bc *BlockChain) GetBodyRLP(hash common.Hash) rlp.RawValue {
 	return body
 }
 
+// GetReceiptsRLP retrieves the receipts of a block in RLP encoding from the
+// database by hash, caching them if found. Nil is returned for unknown blocks.
+func (bc *BlockChain) GetReceiptsRLP(hash common.Hash) rlp.RawValue {
+	// Short circuit if the receipts are already in the cache, retrieve otherwise
+	if cached, ok := bc.receiptsRLPCache.Get(hash); ok {
+		return cached
+	}
+	number := bc.hc.GetBlockNumber(hash)
+	if number == nil {
+		return nil
+	}
+	receipts := rawdb.ReadReceiptsRLP(bc.db, hash, *number)
+	if len(receipts) == 0 {
+		return nil
+	}
+	// Cache the found receipts for next time and return
+	bc.receiptsRLPCache.Add(hash, receipts)
+	return receipts
+}
+
 // HasBlock checks if a block is fully present in the database or not.
 func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
 	if bc.blockCache.Contains(hash) {
@@ -172,6 +715,40 @@ func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
 	return rawdb.HasBody(bc.db, hash, number)
 }
 
+// HasBlocks is the batched version of HasBlock, reporting for each of the given
+// blocks whether it's fully present. The checks are done in the same order as
+// HasBlock (cache, header, body), with the body checks batched into a single
+// database operation. The result is index-aligned with the given blocks.
+func (bc *BlockChain) HasBlocks(pairs []struct {
+	Hash   common.Hash
+	Number uint64
+}) []bool {
+	var (
+		has     = make([]bool, len(pairs))
+		indices []int
+		hashes  []common.Hash
+		numbers []uint64
+	)
+	for i, pair := range pairs {
+		if bc.blockCache.Contains(pair.Hash) {
+			has[i] = true
+			continue
+		}
+		if !bc.HasHeader(pair.Hash, pair.Number) {
+			continue
+		}
+		indices = append(indices, i)
+		hashes = append(hashes, pair.Hash)
+		numbers = append(numbers, pair.Number)
+	}
+	if len(indices) > 0 {
+		for j, ok := range rawdb.HasBodies(bc.db, hashes, numbers) {
+			has[indices[j]] = ok
+		}
+	}
+	return has
+}
+
 // HasFastBlock checks if a fast block is fully present in the database or not.
 func (bc *BlockChain) HasFastBlock(hash common.Hash, number uint64) bool {
 	if !bc.HasBlock(hash, number) {
@@ -183,6 +760,94 @@ func (bc *BlockChain) HasFastBlock(hash common.Hash, number uint64) bool {
 	return rawdb.HasReceipts(bc.db, hash, number)
 }
 
+// HasSidecars checks if the blob sidecars of a block are present in the cache
+// or database. Blocks predating Cancun never carry sidecars, false is returned
+// for them without hitting the database.
+func (bc *BlockChain) HasSidecars(hash common.Hash, number uint64) bool {
+	if bc.sidecarsCache.Contains(hash) {
+		return true
+	}
+	header := bc.GetHeader(hash, number)
+	if header == nil || !bc.chainConfig.IsCancun(header.Number, header.Time) {
+		return false
+	}
+	return rawdb.HasBlobSidecars(bc.db, hash, number)
+}
+
+// MissingSidecars walks the canonical blocks in the range [from, to] and returns
+// the numbers of those carrying blobs whose sidecars are not present in the
+// database. Pre-Cancun blocks and blocks without blob transactions are skipped.
+func (bc *BlockChain) MissingSidecars(from, to uint64) ([]uint64, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid block range: from %d > to %d", from, to)
+	}
+	if to-from >= maxBlockRangeQuery {
+		return nil, fmt.Errorf("block range too large: %d > %d", to-from+1, maxBlockRangeQuery)
+	}
+	var missing []uint64
+	for number := from; number <= to; number++ {
+		hash := bc.hc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			return nil, fmt.Errorf("canonical hash #%d not found", number)
+		}
+		header := bc.hc.GetHeader(hash, number)
+		if header == nil {
+			return nil, fmt.Errorf("canonical header #%d [%x..] not found", number, hash[:4])
+		}
+		if !bc.chainConfig.IsCancun(header.Number, header.Time) {
+			continue
+		}
+		if header.BlobGasUsed == nil || *header.BlobGasUsed == 0 {
+			continue
+		}
+		if !rawdb.HasBlobSidecars(bc.db, hash, number) {
+			missing = append(missing, number)
+		}
+	}
+	return missing, nil
+}
+
+// BlobStatsInRange is like BlobStatsInRangeContext, without cancellation.
+func (bc *BlockChain) BlobStatsInRange(from, to uint64) (blobTxs, totalBlobs uint64, err error) {
+	return bc.BlobStatsInRangeContext(context.Background(), from, to)
+}
+
+// BlobStatsInRangeContext counts the blob-carrying transactions and the total
+// number of blobs in the canonical blocks in the range [from, to], based on the
+// stored sidecars. Pre-Cancun blocks are skipped.
+func (bc *BlockChain) BlobStatsInRangeContext(ctx context.Context, from, to uint64) (blobTxs, totalBlobs uint64, err error) {
+	if from > to {
+		return 0, 0, fmt.Errorf("invalid block range: from %d > to %d", from, to)
+	}
+	if to-from >= maxBlockRangeQuery {
+		return 0, 0, fmt.Errorf("block range too large: %d > %d", to-from+1, maxBlockRangeQuery)
+	}
+	for number := from; number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		hash := bc.hc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			return 0, 0, fmt.Errorf("canonical hash #%d not found", number)
+		}
+		header := bc.hc.GetHeader(hash, number)
+		if header == nil {
+			return 0, 0, fmt.Errorf("canonical header #%d [%x..] not found", number, hash[:4])
+		}
+		if !bc.chainConfig.IsCancun(header.Number, header.Time) {
+			continue
+		}
+		if header.BlobGasUsed == nil || *header.BlobGasUsed == 0 {
+			continue
+		}
+		for _, sidecar := range bc.GetSidecarsByHash(hash) {
+			blobTxs++
+			totalBlobs += uint64(len(sidecar.Blobs))
+		}
+	}
+	return blobTxs, totalBlobs, nil
+}
+
 // GetBlock retrieves a block from the database by hash and number,
 // caching it if found.
 func (bc *BlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
@@ -190,6 +855,11 @@ func (bc *BlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
 	if block, ok := bc.blockCache.Get(hash); ok {
 		return block
 	}
+	// Pinned blocks might have been evicted from the cache, reinstate them
+	if block := bc.pinnedBlock(hash); block != nil {
+		bc.blockCache.Add(hash, block)
+		return block
+	}
 	block := rawdb.ReadBlock(bc.db, hash, number)
 	if block == nil {
 		return nil
@@ -199,6 +869,49 @@ func (bc *BlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
 	return block
 }
 
+// PinBlock keeps the block with the given hash resident in memory, so it's
+// served without disk access even after being evicted from the block cache.
+// An error is returned if the block is unknown or the pin limit is reached.
+// Pins are dropped when the chain head is rewound.
+func (bc *BlockChain) PinBlock(hash common.Hash) error {
+	number := bc.hc.GetBlockNumber(hash)
+	if number == nil {
+		return fmt.Errorf("block %x not found", hash)
+	}
+	block := bc.GetBlock(hash, *number)
+	if block == nil {
+		return fmt.Errorf("block #%d [%x..] not found", *number, hash[:4])
+	}
+	bc.pinnedLock.Lock()
+	defer bc.pinnedLock.Unlock()
+
+	if _, ok := bc.pinnedBlocks[hash]; ok {
+		return nil
+	}
+	if len(bc.pinnedBlocks) >= bc.maxPinnedBlocks {
+		return fmt.Errorf("too many pinned blocks: limit %d", bc.maxPinnedBlocks)
+	}
+	bc.pinnedBlocks[hash] = block
+	return nil
+}
+
+// UnpinBlock releases a block previously pinned with PinBlock, leaving it to
+// the regular cache eviction policy. Unpinning an unpinned block is a no-op.
+func (bc *BlockChain) UnpinBlock(hash common.Hash) {
+	bc.pinnedLock.Lock()
+	defer bc.pinnedLock.Unlock()
+
+	delete(bc.pinnedBlocks, hash)
+}
+
+// pinnedBlock retrieves the pinned block with the given hash, if any.
+func (bc *BlockChain) pinnedBlock(hash common.Hash) *types.Block {
+	bc.pinnedLock.RLock()
+	defer bc.pinnedLock.RUnlock()
+
+	return bc.pinnedBlocks[hash]
+}
+
 // GetBlockByHash retrieves a block from the database by hash, caching it if found.
 func (bc *BlockChain) GetBlockByHash(hash common.Hash) *types.Block {
 	number := bc.hc.GetBlockNumber(hash)
@@ -211,38 +924,356 @@ func (bc *BlockChain) GetBlockByHash(hash common.Hash) *types.Block {
 // GetBlockByNumber retrieves a block from the database by number, caching it
 // (associated with its hash) if found.
 func (bc *BlockChain) GetBlockByNumber(number uint64) *types.Block {
-	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	hash := bc.canonicalHash(number)
 	if hash == (common.Hash{}) {
 		return nil
 	}
 	return bc.GetBlock(hash, number)
 }
 
-// GetBlocksFromHash returns the block corresponding to hash and up to n-1 ancestors.
-// [deprecated by eth/62]
-func (bc *BlockChain) GetBlocksFromHash(hash common.Hash, n int) (blocks []*types.Block) {
-	number := bc.hc.GetBlockNumber(hash)
-	if number == nil {
-		return nil
+// canonicalHash retrieves the canonical hash assigned to a block number, going
+// through the canonical hash cache. A database read is only cached if no head
+// change happened in the meantime, otherwise it might already be stale.
+func (bc *BlockChain) canonicalHash(number uint64) common.Hash {
+	bc.canonHashLock.Lock()
+	hash, ok := bc.canonHashCache.Get(number)
+	gen := bc.canonHashGen
+	bc.canonHashLock.Unlock()
+	if ok {
+		return hash
 	}
-	for i := 0; i < n; i++ {
-		block := bc.GetBlock(hash, *number)
+	if hash = rawdb.ReadCanonicalHash(bc.db, number); hash == (common.Hash{}) {
+		return hash
+	}
+	bc.canonHashLock.Lock()
+	if bc.canonHashGen == gen {
+		bc.canonHashCache.Add(number, hash)
+	}
+	bc.canonHashLock.Unlock()
+	return hash
+}
+
+// GetBlockByNumberOrHash retrieves a block either by number, including the
+// "latest", "safe" and "finalized" tags, or by hash, enforcing the block to be
+// canonical if requested. The pending block is not known by the chain, an
+// error is returned for it. Nil is returned for unknown block numbers.
+func (bc *BlockChain) GetBlockByNumberOrHash(bnh rpc.BlockNumberOrHash) (*types.Block, error) {
+	if number, ok := bnh.Number(); ok {
+		var header *types.Header
+		switch number {
+		case rpc.PendingBlockNumber:
+			return nil, errors.New("pending block is not available")
+		case rpc.LatestBlockNumber:
+			header = bc.CurrentBlock()
+		case rpc.FinalizedBlockNumber:
+			if header = bc.CurrentFinalBlock(); header == nil {
+				return nil, errors.New("finalized block not found")
+			}
+		case rpc.SafeBlockNumber:
+			if header = bc.CurrentSafeBlock(); header == nil {
+				return nil, errors.New("safe block not found")
+			}
+		default:
+			return bc.GetBlockByNumber(uint64(number)), nil
+		}
+		return bc.GetBlock(header.Hash(), header.Number.Uint64()), nil
+	}
+	if hash, ok := bnh.Hash(); ok {
+		header := bc.GetHeaderByHash(hash)
+		if header == nil {
+			return nil, errors.New("header for hash not found")
+		}
+		if bnh.RequireCanonical && bc.GetCanonicalHash(header.Number.Uint64()) != hash {
+			return nil, errors.New("hash is not currently canonical")
+		}
+		block := bc.GetBlock(hash, header.Number.Uint64())
 		if block == nil {
-			break
+			return nil, errors.New("header found, but block body is missing")
 		}
-		blocks = append(blocks, block)
-		hash = block.ParentHash()
-		*number--
+		return block, nil
 	}
-	return
+	return nil, errors.New("invalid arguments; neither block nor hash specified")
 }
 
-// GetReceiptsByHash retrieves the receipts for all transactions in a given block.
-func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
-	if receipts, ok := bc.receiptsCache.Get(hash); ok {
-		return receipts
-	}
-	number := rawdb.ReadHeaderNumber(bc.db, hash)
+// WaitForBlock waits until the canonical chain reaches the given block number
+// and returns the canonical block at that height. It returns immediately if the
+// block is already canonical, otherwise it blocks until the head catches up or
+// the context is cancelled.
+func (bc *BlockChain) WaitForBlock(ctx context.Context, number uint64) (*types.Block, error) {
+	// Subscribe before checking the head, so no head event can slip in between
+	var (
+		headCh = make(chan ChainHeadEvent, 1)
+		sub    = bc.SubscribeChainHeadEvent(headCh)
+	)
+	defer sub.Unsubscribe()
+
+	for {
+		if bc.CurrentBlock().Number.Uint64() >= number {
+			if block := bc.GetBlockByNumber(number); block != nil {
+				return block, nil
+			}
+		}
+		select {
+		case <-headCh:
+		case err := <-sub.Err():
+			if err == nil {
+				err = errChainStopped
+			}
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// StreamChainHeadsFrom delivers a ChainHeadEvent for every canonical block from
+// the given number onwards: the existing blocks are replayed first, after which
+// newly imported heads are delivered as they arrive. Every block is delivered
+// once and in order. If the delivered chain is reorged out, delivery restarts
+// from the block following the common ancestor with the new canonical chain.
+// Intermediate heads of a batch import are delivered too, unlike on the live
+// head feed.
+//
+// The method blocks until the context is cancelled or the chain is stopped.
+func (bc *BlockChain) StreamChainHeadsFrom(ctx context.Context, from uint64, ch chan<- ChainHeadEvent) error {
+	// Subscribe before replaying, so no head event can slip in between
+	var (
+		headCh = make(chan ChainHeadEvent, 1)
+		sub    = bc.SubscribeChainHeadEvent(headCh)
+	)
+	defer sub.Unsubscribe()
+
+	// The head feed must not be blocked by a slow consumer, so it's drained
+	// while waiting for delivery. The canonical chain is re-read afterwards,
+	// hence no head is lost.
+	deliver := func(header *types.Header) error {
+		for {
+			select {
+			case ch <- ChainHeadEvent{Header: header}:
+				return nil
+			case <-headCh:
+			case err := <-sub.Err():
+				if err == nil {
+					err = errChainStopped
+				}
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	var (
+		last *types.Header // Last delivered header
+		next = from        // Number of the next header to deliver
+	)
+	for {
+		for {
+			head := bc.CurrentBlock()
+			if last != nil && bc.GetCanonicalHash(last.Number.Uint64()) != last.Hash() {
+				ancestor, err := bc.FindCommonAncestor(last, head)
+				if err != nil {
+					return err
+				}
+				last, next = ancestor, ancestor.Number.Uint64()+1
+			}
+			if next > head.Number.Uint64() {
+				break
+			}
+			header := bc.GetHeaderByNumber(next)
+			if header == nil {
+				if bc.CurrentBlock().Hash() == head.Hash() {
+					return fmt.Errorf("canonical header #%d not found", next)
+				}
+				continue // Reorged meanwhile, retry on the new chain
+			}
+			if last != nil && header.ParentHash != last.Hash() {
+				continue // Reorged meanwhile, rewind on the next iteration
+			}
+			if err := deliver(header); err != nil {
+				return err
+			}
+			last, next = header, next+1
+		}
+		select {
+		case <-headCh:
+		case err := <-sub.Err():
+			if err == nil {
+				err = errChainStopped
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// GetBlocksByRange retrieves the canonical blocks in the range [from, to] in
+// ascending order, caching them if found. The retrieval stops at the first
+// missing block instead of returning an error, so the result may be shorter
+// than the requested range. At most maxBlockRangeQuery blocks may be requested.
+func (bc *BlockChain) GetBlocksByRange(from, to uint64) ([]*types.Block, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid block range: from %d > to %d", from, to)
+	}
+	head := bc.CurrentBlock().Number.Uint64()
+	if from > head {
+		return nil, nil
+	}
+	if to > head {
+		to = head
+	}
+	if to-from >= maxBlockRangeQuery {
+		return nil, fmt.Errorf("block range too large: %d > %d", to-from+1, maxBlockRangeQuery)
+	}
+	hashes := rawdb.ReadCanonicalHashes(bc.db, from, to)
+	blocks := make([]*types.Block, 0, len(hashes))
+	for i, hash := range hashes {
+		if hash == (common.Hash{}) {
+			break
+		}
+		number := from + uint64(i)
+		block, ok := bc.blockCache.Get(hash)
+		if !ok {
+			if block = rawdb.ReadBlock(bc.db, hash, number); block == nil {
+				break
+			}
+			bc.blockCache.Add(hash, block)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// GetBlockRangeRLP retrieves the canonical blocks in the range [from, to] in RLP
+// encoding, in ascending order. Each block is assembled from its header and body
+// RLP without decoding them. The range is truncated at the current chain head
+// and the retrieval stops at the first missing block.
+func (bc *BlockChain) GetBlockRangeRLP(from, to uint64) ([]rlp.RawValue, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid block range: from %d > to %d", from, to)
+	}
+	head := bc.CurrentBlock().Number.Uint64()
+	if from > head {
+		return nil, nil
+	}
+	if to > head {
+		to = head
+	}
+	if to-from >= maxBlockRangeQuery {
+		return nil, fmt.Errorf("block range too large: %d > %d", to-from+1, maxBlockRangeQuery)
+	}
+	blocks := make([]rlp.RawValue, 0, to-from+1)
+	for number := from; number <= to; number++ {
+		hash := bc.hc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			break
+		}
+		header := rawdb.ReadHeaderRLP(bc.db, hash, number)
+		if len(header) == 0 {
+			break
+		}
+		body := bc.GetBodyRLP(hash)
+		if len(body) == 0 {
+			break
+		}
+		// The block is a list of the header followed by the body fields, so
+		// splice the header in front of the body's list content.
+		content, _, err := rlp.SplitList(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body #%d [%x..]: %v", number, hash[:4], err)
+		}
+		w := rlp.NewEncoderBuffer(nil)
+		l := w.List()
+		w.Write(header)
+		w.Write(content)
+		w.ListEnd(l)
+		blocks = append(blocks, w.ToBytes())
+	}
+	return blocks, nil
+}
+
+// GetTransactionAt retrieves the transaction at the given position of the
+// canonical block with the given number. The body is served from the cache
+// if available, bypassing the transaction lookup index altogether.
+func (bc *BlockChain) GetTransactionAt(blockNumber uint64, txIndex uint64) (*types.Transaction, error) {
+	hash := bc.GetCanonicalHash(blockNumber)
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("block #%d not found", blockNumber)
+	}
+	body := bc.GetBody(hash)
+	if body == nil {
+		return nil, fmt.Errorf("block body #%d [%x..] not found", blockNumber, hash[:4])
+	}
+	if txIndex >= uint64(len(body.Transactions)) {
+		return nil, fmt.Errorf("transaction index %d out of range, block #%d has %d transactions", txIndex, blockNumber, len(body.Transactions))
+	}
+	return body.Transactions[txIndex], nil
+}
+
+// GetTransactionByPosition retrieves the transaction at the given position of
+// the block with the given hash, which needn't be canonical. The body is served
+// from the cache if available.
+func (bc *BlockChain) GetTransactionByPosition(blockHash common.Hash, index uint) (*types.Transaction, error) {
+	body := bc.GetBody(blockHash)
+	if body == nil {
+		return nil, fmt.Errorf("block %x not found", blockHash)
+	}
+	if index >= uint(len(body.Transactions)) {
+		return nil, fmt.Errorf("transaction index %d out of range, block %x has %d transactions", index, blockHash, len(body.Transactions))
+	}
+	return body.Transactions[index], nil
+}
+
+// GetWithdrawals retrieves the withdrawals of the block with the given hash,
+// served from the cached body or block if available. Nil is returned for blocks
+// predating Shanghai.
+func (bc *BlockChain) GetWithdrawals(hash common.Hash) (types.Withdrawals, error) {
+	body := bc.GetBody(hash)
+	if body == nil {
+		return nil, fmt.Errorf("block body %x not found", hash)
+	}
+	return body.Withdrawals, nil
+}
+
+// GetWithdrawalsByNumber retrieves the withdrawals of the canonical block with
+// the given number. Nil is returned for blocks predating Shanghai.
+func (bc *BlockChain) GetWithdrawalsByNumber(number uint64) (types.Withdrawals, error) {
+	hash := bc.GetCanonicalHash(number)
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	body := bc.GetBody(hash)
+	if body == nil {
+		return nil, fmt.Errorf("block body #%d [%x..] not found", number, hash[:4])
+	}
+	return body.Withdrawals, nil
+}
+
+// GetBlocksFromHash returns the block corresponding to hash and up to n-1 ancestors.
+// [deprecated by eth/62]
+func (bc *BlockChain) GetBlocksFromHash(hash common.Hash, n int) (blocks []*types.Block) {
+	number := bc.hc.GetBlockNumber(hash)
+	if number == nil {
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		block := bc.GetBlock(hash, *number)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+		hash = block.ParentHash()
+		*number--
+	}
+	return
+}
+
+// GetReceiptsByHash retrieves the receipts for all transactions in a given block.
+func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
+	if receipts, ok := bc.receiptsCache.Get(hash); ok {
+		return receipts
+	}
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
 	if number == nil {
 		return nil
 	}
@@ -254,180 +1285,1919 @@ func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	if receipts == nil {
 		return nil
 	}
-	bc.receiptsCache.Add(hash, receipts)
-	return receipts
+	bc.receiptsCache.Add(hash, receipts)
+	return receipts
+}
+
+// GetDerivedReceipts retrieves the receipts of all transactions in a given block
+// with all the derived fields filled in from the block context, like
+// GetReceiptsByHash, but reports why they are unavailable: an error is returned
+// if the block is unknown or its receipts cannot be derived.
+//
+// The returned receipts are shared with the receipt cache, callers must not
+// mutate them.
+func (bc *BlockChain) GetDerivedReceipts(hash common.Hash) (types.Receipts, error) {
+	number := bc.hc.GetBlockNumber(hash)
+	if number == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	receipts := bc.GetReceiptsByHash(hash)
+	if receipts == nil {
+		return nil, fmt.Errorf("receipts #%d [%x..] not found", *number, hash[:4])
+	}
+	return receipts, nil
+}
+
+// GetLogsByHash retrieves the logs of all transactions in a given block, grouped
+// per transaction. Logs are decoded from the stored receipts without the other
+// receipt fields where possible, falling back to the full receipts otherwise.
+// The block and transaction context fields of the logs are filled in either way,
+// taking the transaction hashes from the block body.
+func (bc *BlockChain) GetLogsByHash(hash common.Hash) ([][]*types.Log, error) {
+	if receipts, ok := bc.receiptsCache.Get(hash); ok {
+		return receiptLogs(receipts), nil
+	}
+	number := bc.hc.GetBlockNumber(hash)
+	if number == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	logs := rawdb.ReadLogs(bc.db, hash, *number)
+	if logs == nil {
+		receipts := bc.GetReceiptsByHash(hash)
+		if receipts == nil {
+			return nil, fmt.Errorf("receipts #%d [%x..] not found", *number, hash[:4])
+		}
+		return receiptLogs(receipts), nil
+	}
+	// Database logs are un-derived, fill in the context fields from the body
+	body := bc.GetBody(hash)
+	if body == nil {
+		return nil, fmt.Errorf("body #%d [%x..] not found", *number, hash[:4])
+	}
+	if len(body.Transactions) != len(logs) {
+		return nil, fmt.Errorf("log count mismatch of block #%d [%x..]: %d transactions, %d receipts", *number, hash[:4], len(body.Transactions), len(logs))
+	}
+	var index uint
+	for i, txLogs := range logs {
+		for _, l := range txLogs {
+			l.BlockHash = hash
+			l.BlockNumber = *number
+			l.TxHash = body.Transactions[i].Hash()
+			l.TxIndex = uint(i)
+			l.Index = index
+			index++
+		}
+	}
+	return logs, nil
+}
+
+// receiptLogs groups the logs of the given receipts per transaction.
+func receiptLogs(receipts types.Receipts) [][]*types.Log {
+	logs := make([][]*types.Log, len(receipts))
+	for i, receipt := range receipts {
+		logs[i] = receipt.Logs
+	}
+	return logs
+}
+
+// GetLogsByAddress retrieves the logs emitted by the given contract in the block
+// with the given hash, with all block and transaction context fields filled in.
+// The receipts are only read if the block bloom matches the address, an empty
+// slice is returned otherwise.
+func (bc *BlockChain) GetLogsByAddress(hash common.Hash, addr common.Address) ([]*types.Log, error) {
+	header := bc.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	addresses := []common.Address{addr}
+	if !bloomMatches(header.Bloom, addresses, nil) {
+		return []*types.Log{}, nil
+	}
+	receipts := bc.GetReceiptsByHash(hash)
+	if receipts == nil {
+		return nil, fmt.Errorf("receipts #%d [%x..] not found", header.Number, hash[:4])
+	}
+	logs := []*types.Log{}
+	for _, receipt := range receipts {
+		for _, l := range receipt.Logs {
+			if l.Address == addr {
+				logs = append(logs, l)
+			}
+		}
+	}
+	return logs, nil
+}
+
+// FilterLogsInRange is like FilterLogsInRangeContext, without cancellation.
+func (bc *BlockChain) FilterLogsInRange(from, to uint64, addresses []common.Address, topics [][]common.Hash) ([]*types.Log, error) {
+	return bc.FilterLogsInRangeContext(context.Background(), from, to, addresses, topics)
+}
+
+// FilterLogsInRangeContext retrieves the logs of the canonical blocks in the
+// range [from, to] matching the given addresses and topics, with the same
+// semantics as the log filters of the RPC API: an empty address list or topic
+// position matches anything. The bloom of each header is checked before the
+// receipts are loaded, so non-matching blocks are skipped cheaply.
+func (bc *BlockChain) FilterLogsInRangeContext(ctx context.Context, from, to uint64, addresses []common.Address, topics [][]common.Hash) ([]*types.Log, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid block range: from %d > to %d", from, to)
+	}
+	if to-from >= maxBlockRangeQuery {
+		return nil, fmt.Errorf("block range too large: %d > %d", to-from+1, maxBlockRangeQuery)
+	}
+	var logs []*types.Log
+	for number := from; number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hash := bc.hc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			return nil, fmt.Errorf("canonical hash #%d not found", number)
+		}
+		header := bc.hc.GetHeader(hash, number)
+		if header == nil {
+			return nil, fmt.Errorf("canonical header #%d [%x..] not found", number, hash[:4])
+		}
+		if !bloomMatches(header.Bloom, addresses, topics) {
+			continue
+		}
+		receipts := bc.GetReceiptsByHash(hash)
+		if receipts == nil {
+			return nil, fmt.Errorf("receipts #%d [%x..] not found", number, hash[:4])
+		}
+		for _, receipt := range receipts {
+			for _, l := range receipt.Logs {
+				if logMatches(l, addresses, topics) {
+					logs = append(logs, l)
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+// bloomMatches reports whether the given bloom may contain logs matching the
+// address and topic criteria.
+func bloomMatches(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 && !slices.ContainsFunc(addresses, func(addr common.Address) bool {
+		return types.BloomLookup(bloom, addr)
+	}) {
+		return false
+	}
+	for _, sub := range topics {
+		if len(sub) == 0 {
+			continue // empty rule set == wildcard
+		}
+		if !slices.ContainsFunc(sub, func(topic common.Hash) bool {
+			return types.BloomLookup(bloom, topic)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// logMatches reports whether the given log matches the address and topic
+// criteria.
+func logMatches(l *types.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 && !slices.Contains(addresses, l.Address) {
+		return false
+	}
+	// If the filtered topics are more than the topics of the log, skip
+	if len(topics) > len(l.Topics) {
+		return false
+	}
+	for i, sub := range topics {
+		if len(sub) == 0 {
+			continue // empty rule set == wildcard
+		}
+		if !slices.Contains(sub, l.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetReceiptsInRange is like GetReceiptsInRangeContext, without cancellation.
+func (bc *BlockChain) GetReceiptsInRange(from, to uint64) ([]types.Receipts, error) {
+	return bc.GetReceiptsInRangeContext(context.Background(), from, to)
+}
+
+// GetReceiptsInRangeContext retrieves the receipts of the canonical blocks in
+// the range [from, to], in ascending order. The canonical hashes are resolved in
+// a single database pass, cached receipts are served from memory and blocks
+// without receipts are skipped without touching the database.
+func (bc *BlockChain) GetReceiptsInRangeContext(ctx context.Context, from, to uint64) ([]types.Receipts, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid block range: from %d > to %d", from, to)
+	}
+	if to-from >= maxBlockRangeQuery {
+		return nil, fmt.Errorf("block range too large: %d > %d", to-from+1, maxBlockRangeQuery)
+	}
+	hashes := rawdb.ReadCanonicalHashes(bc.db, from, to)
+	result := make([]types.Receipts, 0, len(hashes))
+	for i, hash := range hashes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		number := from + uint64(i)
+		if hash == (common.Hash{}) {
+			return nil, fmt.Errorf("canonical hash #%d not found", number)
+		}
+		if receipts, ok := bc.receiptsCache.Get(hash); ok {
+			result = append(result, receipts)
+			continue
+		}
+		header := bc.hc.GetHeader(hash, number)
+		if header == nil {
+			return nil, fmt.Errorf("canonical header #%d [%x..] not found", number, hash[:4])
+		}
+		if header.ReceiptHash == types.EmptyReceiptsHash {
+			result = append(result, types.Receipts{})
+			continue
+		}
+		receipts := rawdb.ReadReceipts(bc.db, hash, number, header.Time, bc.chainConfig)
+		if receipts == nil {
+			return nil, fmt.Errorf("receipts #%d [%x..] not found", number, hash[:4])
+		}
+		bc.receiptsCache.Add(hash, receipts)
+		result = append(result, receipts)
+	}
+	return result, nil
+}
+
+// GetReceiptsByHashes retrieves the receipts for all transactions of multiple
+// blocks. Duplicate hashes are only resolved once and cached receipts are served
+// before touching the database. The returned slices are index-aligned with the
+// given hashes; unknown blocks yield nil receipts along with a nil error.
+func (bc *BlockChain) GetReceiptsByHashes(hashes []common.Hash) ([]types.Receipts, []error) {
+	var (
+		receipts = make([]types.Receipts, len(hashes))
+		errs     = make([]error, len(hashes))
+		first    = make(map[common.Hash]int, len(hashes))
+		missing  []int
+	)
+	// Serve everything available from the cache, collecting the misses
+	for i, hash := range hashes {
+		if _, ok := first[hash]; ok {
+			continue
+		}
+		first[hash] = i
+		if cached, ok := bc.receiptsCache.Get(hash); ok {
+			receipts[i] = cached
+			continue
+		}
+		missing = append(missing, i)
+	}
+	// Read the remaining receipts from the database
+	for _, i := range missing {
+		hash := hashes[i]
+		number := rawdb.ReadHeaderNumber(bc.db, hash)
+		if number == nil {
+			continue
+		}
+		header := bc.GetHeader(hash, *number)
+		if header == nil {
+			errs[i] = fmt.Errorf("header #%d [%x..] not found", *number, hash[:4])
+			continue
+		}
+		result := rawdb.ReadReceipts(bc.db, hash, *number, header.Time, bc.chainConfig)
+		if result == nil {
+			continue
+		}
+		bc.receiptsCache.Add(hash, result)
+		receipts[i] = result
+	}
+	// Fill in the results of the duplicate hashes
+	for i, hash := range hashes {
+		if j := first[hash]; j != i {
+			receipts[i], errs[i] = receipts[j], errs[j]
+		}
+	}
+	return receipts, errs
+}
+
+// ReceiptStatusHistogram counts the successful and failed transactions in the
+// canonical blocks of the range [start, end]. The receipts of the whole range
+// are retrieved in one batch.
+func (bc *BlockChain) ReceiptStatusHistogram(start, end uint64) (success, failed uint64, err error) {
+	if start > end {
+		return 0, 0, fmt.Errorf("invalid block range: start %d > end %d", start, end)
+	}
+	if end-start >= maxBlockRangeQuery {
+		return 0, 0, fmt.Errorf("block range too large: %d > %d", end-start+1, maxBlockRangeQuery)
+	}
+	hashes := make([]common.Hash, 0, end-start+1)
+	for number := start; number <= end; number++ {
+		hash := bc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			return 0, 0, fmt.Errorf("block #%d not found", number)
+		}
+		hashes = append(hashes, hash)
+	}
+	receipts, errs := bc.GetReceiptsByHashes(hashes)
+	for i, blockReceipts := range receipts {
+		if errs[i] != nil {
+			return 0, 0, errs[i]
+		}
+		if blockReceipts == nil {
+			return 0, 0, fmt.Errorf("receipts #%d [%x..] not found", start+uint64(i), hashes[i][:4])
+		}
+		for _, receipt := range blockReceipts {
+			if receipt.Status == types.ReceiptStatusSuccessful {
+				success++
+			} else {
+				failed++
+			}
+		}
+	}
+	return success, failed, nil
+}
+
+// GetSidecarsByHash retrieves the sidecars for all transactions in a given block.
+func (bc *BlockChain) GetSidecarsByHash(hash common.Hash) types.BlobSidecars {
+	if sidecars, ok := bc.sidecarsCache.Get(hash); ok {
+		return sidecars
+	}
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	sidecars := rawdb.ReadBlobSidecars(bc.db, hash, *number)
+	if sidecars == nil {
+		return nil
+	}
+	bc.sidecarsCache.Add(hash, sidecars)
+	return sidecars
+}
+
+// GetBlockWithSidecars retrieves the canonical block with the given hash along
+// with its blob sidecars, both served from the caches if available. The block
+// must be canonical both before and after the reads, so the pair is never
+// assembled across a reorg. The sidecars are nil for pre-Cancun blocks.
+func (bc *BlockChain) GetBlockWithSidecars(hash common.Hash) (*types.Block, types.BlobSidecars, error) {
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return nil, nil, fmt.Errorf("block %x not found", hash)
+	}
+	number := block.NumberU64()
+	if bc.GetCanonicalHash(number) != hash {
+		return nil, nil, fmt.Errorf("block #%d [%x..] is not canonical", number, hash[:4])
+	}
+	if !bc.chainConfig.IsCancun(block.Number(), block.Time()) {
+		return block, nil, nil
+	}
+	sidecars := bc.GetSidecarsByHash(hash)
+	if bc.GetCanonicalHash(number) != hash {
+		return nil, nil, fmt.Errorf("block #%d [%x..] reorged during retrieval", number, hash[:4])
+	}
+	return block, sidecars, nil
+}
+
+// GetSidecarsRLP retrieves the blob sidecars of a block in RLP encoding from the
+// database by hash, caching them if found. Nil is returned for unknown blocks
+// and blocks preceding Cancun.
+func (bc *BlockChain) GetSidecarsRLP(hash common.Hash) rlp.RawValue {
+	// Short circuit if the sidecars are already in the cache, retrieve otherwise
+	if cached, ok := bc.sidecarsRLPCache.Get(hash); ok {
+		return cached
+	}
+	number := bc.hc.GetBlockNumber(hash)
+	if number == nil {
+		return nil
+	}
+	header := bc.GetHeader(hash, *number)
+	if header == nil || !bc.chainConfig.IsCancun(header.Number, header.Time) {
+		return nil
+	}
+	sidecars := rawdb.ReadBlobSidecarsRLP(bc.db, hash, *number)
+	if len(sidecars) == 0 {
+		return nil
+	}
+	// Cache the found sidecars for next time and return
+	bc.sidecarsRLPCache.Add(hash, sidecars)
+	return sidecars
+}
+
+// GetSidecarByTxHash retrieves the blob sidecar of the transaction with the
+// given hash, along with the hash of the block containing it. Nil is returned
+// if the transaction is unknown and errNotBlobTx if it carries no blobs.
+func (bc *BlockChain) GetSidecarByTxHash(txHash common.Hash) (*types.BlobSidecar, common.Hash, error) {
+	lookup, tx, err := bc.GetTransactionLookup(txHash)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	if lookup == nil {
+		return nil, common.Hash{}, nil
+	}
+	if tx.Type() != types.BlobTxType {
+		return nil, lookup.BlockHash, errNotBlobTx
+	}
+	for _, sidecar := range bc.GetSidecarsByHash(lookup.BlockHash) {
+		if sidecar.TxIndex == lookup.Index {
+			return sidecar, lookup.BlockHash, nil
+		}
+	}
+	return nil, lookup.BlockHash, fmt.Errorf("sidecar of transaction %x not found", txHash)
+}
+
+// GetUnclesInChain retrieves all the uncles from a given block backwards until
+// a specific distance is reached.
+func (bc *BlockChain) GetUnclesInChain(block *types.Block, length int) []*types.Header {
+	uncles := []*types.Header{}
+	for i := 0; block != nil && i < length; i++ {
+		uncles = append(uncles, block.Uncles()...)
+		block = bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	}
+	return uncles
+}
+
+// GetUncleHashesInChain is like GetUnclesInChain, but only collects the uncle
+// hashes. The result is nil if there are no uncles in the range, which is the
+// common case on BSC.
+func (bc *BlockChain) GetUncleHashesInChain(block *types.Block, length int) []common.Hash {
+	var hashes []common.Hash
+	for i := 0; block != nil && i < length; i++ {
+		for _, uncle := range block.Uncles() {
+			hashes = append(hashes, uncle.Hash())
+		}
+		block = bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	}
+	return hashes
+}
+
+// GetCanonicalHash returns the canonical hash for a given block number
+func (bc *BlockChain) GetCanonicalHash(number uint64) common.Hash {
+	return bc.canonicalHash(number)
+}
+
+// GetCanonicalHashes returns the canonical hashes of the blocks in the range
+// [from, to], filling zero hashes for the numbers without a canonical block. The
+// result is nil if the range is invalid or exceeds maxBlockRangeQuery blocks.
+func (bc *BlockChain) GetCanonicalHashes(from, to uint64) []common.Hash {
+	if from > to || to-from >= maxBlockRangeQuery {
+		return nil
+	}
+	return rawdb.ReadCanonicalHashes(bc.db, from, to)
+}
+
+// CanonicalHashDigest computes the keccak256 hash over the concatenation of the
+// canonical hashes in the range [start, end], in ascending order. Nodes can
+// compare digests over shrinking ranges to locate where their canonical chains
+// diverge. An error is returned if any block in the range is missing, or if the
+// range exceeds maxBlockRangeQuery blocks.
+func (bc *BlockChain) CanonicalHashDigest(start, end uint64) (common.Hash, error) {
+	if start > end {
+		return common.Hash{}, fmt.Errorf("invalid block range: start %d > end %d", start, end)
+	}
+	if end-start >= maxBlockRangeQuery {
+		return common.Hash{}, fmt.Errorf("block range too large: %d > %d", end-start+1, maxBlockRangeQuery)
+	}
+	hasher := crypto.NewKeccakState()
+	for number := start; ; number++ {
+		hash := bc.GetCanonicalHash(number)
+		if hash == (common.Hash{}) {
+			return common.Hash{}, fmt.Errorf("block #%d not found", number)
+		}
+		hasher.Write(hash[:])
+		if number == end {
+			break
+		}
+	}
+	var digest common.Hash
+	hasher.Read(digest[:])
+	return digest, nil
+}
+
+// ForkHeads returns the tips of the side chains known to the node, i.e. the
+// non-canonical headers without a known child. Only headers within
+// forkHeadsWindow blocks of the current head are considered.
+func (bc *BlockChain) ForkHeads() []*types.Header {
+	var (
+		number = bc.CurrentBlock().Number.Uint64()
+		start  = uint64(0)
+	)
+	if number > forkHeadsWindow {
+		start = number - forkHeadsWindow
+	}
+	var (
+		parents = make(map[common.Hash]struct{})
+		sides   []*types.Header
+	)
+	for _, entry := range rawdb.ReadAllHashesInRange(bc.db, start, number+forkHeadsWindow) {
+		header := bc.GetHeader(entry.Hash, entry.Number)
+		if header == nil {
+			continue
+		}
+		parents[header.ParentHash] = struct{}{}
+		if bc.GetCanonicalHash(entry.Number) != entry.Hash {
+			sides = append(sides, header)
+		}
+	}
+	var heads []*types.Header
+	for _, header := range sides {
+		if _, ok := parents[header.Hash()]; !ok {
+			heads = append(heads, header)
+		}
+	}
+	return heads
+}
+
+// GetAncestor retrieves the Nth ancestor of a given block. It assumes that either the given block or
+// a close ancestor of it is canonical. maxNonCanonical points to a downwards counter limiting the
+// number of blocks to be individually checked before we reach the canonical chain.
+//
+// Note: ancestor == 0 returns the same block, 1 returns its parent and so on.
+func (bc *BlockChain) GetAncestor(hash common.Hash, number, ancestor uint64, maxNonCanonical *uint64) (common.Hash, uint64) {
+	return bc.hc.GetAncestor(hash, number, ancestor, maxNonCanonical)
+}
+
+// IterateAncestors calls fn with the header of the given block, then with each
+// of its ancestors in descending order. The walk stops when fn returns false,
+// after the genesis header or at the first header missing from the database.
+func (bc *BlockChain) IterateAncestors(hash common.Hash, number uint64, fn func(*types.Header) bool) {
+	for header := bc.GetHeader(hash, number); header != nil; {
+		if !fn(header) || header.Number.Sign() == 0 {
+			return
+		}
+		header = bc.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+}
+
+// VerifyCanonicalChain checks the integrity of the canonical chain links in the
+// range [from, to]: every canonical hash must resolve to a header with the same
+// number and hash, and every header must link to the previous canonical hash.
+// The first inconsistency found is returned. This is a consistency check of the
+// database, the blocks themselves are not validated. At most maxBlockRangeQuery
+// blocks may be checked at once.
+func (bc *BlockChain) VerifyCanonicalChain(from, to uint64) error {
+	if from > to {
+		return fmt.Errorf("invalid block range: from %d > to %d", from, to)
+	}
+	if to-from >= maxBlockRangeQuery {
+		return fmt.Errorf("block range too large: %d > %d", to-from+1, maxBlockRangeQuery)
+	}
+	var parent common.Hash
+	if from > 0 {
+		if parent = rawdb.ReadCanonicalHash(bc.db, from-1); parent == (common.Hash{}) {
+			return fmt.Errorf("canonical hash #%d missing", from-1)
+		}
+	}
+	for number := from; number <= to; number++ {
+		hash := rawdb.ReadCanonicalHash(bc.db, number)
+		if hash == (common.Hash{}) {
+			return fmt.Errorf("canonical hash #%d missing", number)
+		}
+		header := rawdb.ReadHeader(bc.db, hash, number)
+		if header == nil {
+			return fmt.Errorf("canonical header #%d [%x..] missing", number, hash[:4])
+		}
+		if header.Number.Uint64() != number {
+			return fmt.Errorf("canonical header #%d [%x..] number mismatch: have %d", number, hash[:4], header.Number)
+		}
+		if have := header.Hash(); have != hash {
+			return fmt.Errorf("canonical header #%d hash mismatch: have %x, want %x", number, have, hash)
+		}
+		if number > 0 && header.ParentHash != parent {
+			return fmt.Errorf("canonical header #%d [%x..] parent mismatch: have %x, want %x", number, hash[:4], header.ParentHash, parent)
+		}
+		parent = hash
+	}
+	return nil
+}
+
+// IsCanonical reports whether the block with the given hash and number is part
+// of the canonical chain, without loading the block itself.
+func (bc *BlockChain) IsCanonical(hash common.Hash, number uint64) bool {
+	canonical := bc.hc.GetCanonicalHash(number)
+	return canonical != (common.Hash{}) && canonical == hash
+}
+
+// GetCanonicalAncestor retrieves the Nth ancestor of the canonical block with
+// the given number. Unlike GetAncestor, the starting block is assumed to be
+// canonical so the ancestor is resolved directly by number, without walking
+// down the chain. The zero hash is returned if the ancestor would precede the
+// genesis block or is not part of the canonical chain.
+//
+// Note: ancestor == 0 returns the same block, 1 returns its parent and so on.
+func (bc *BlockChain) GetCanonicalAncestor(number, ancestor uint64) (common.Hash, uint64) {
+	if ancestor > number {
+		return common.Hash{}, 0
+	}
+	number -= ancestor
+	return bc.hc.GetCanonicalHash(number), number
+}
+
+// FindCommonAncestor retrieves the closest common ancestor of the two given
+// headers. The higher one is walked back to the height of the lower one, then
+// both are walked back in lockstep until their hashes match. The walk on either
+// chain is bounded by the configured maximum depth (see SetMaxAncestorDepth),
+// an error is returned if no ancestor is found within it.
+func (bc *BlockChain) FindCommonAncestor(a, b *types.Header) (*types.Header, error) {
+	parent := func(header *types.Header) (*types.Header, error) {
+		if header.Number.Sign() == 0 {
+			return nil, errors.New("no common ancestor, different genesis")
+		}
+		number := header.Number.Uint64() - 1
+		if p := bc.GetHeader(header.ParentHash, number); p != nil {
+			return p, nil
+		}
+		return nil, fmt.Errorf("header #%d [%x..] not found", number, header.ParentHash[:4])
+	}
+	// The depth tracks the walk on the longer chain, which is the deeper one
+	var (
+		depth    uint64
+		maxDepth = bc.maxAncestorDepth.Load()
+		err      error
+	)
+	for ; a.Number.Cmp(b.Number) > 0 && depth < maxDepth; depth++ {
+		if a, err = parent(a); err != nil {
+			return nil, err
+		}
+	}
+	for ; b.Number.Cmp(a.Number) > 0 && depth < maxDepth; depth++ {
+		if b, err = parent(b); err != nil {
+			return nil, err
+		}
+	}
+	for ; a.Hash() != b.Hash() && depth < maxDepth; depth++ {
+		if a, err = parent(a); err != nil {
+			return nil, err
+		}
+		if b, err = parent(b); err != nil {
+			return nil, err
+		}
+	}
+	if a.Hash() != b.Hash() {
+		return nil, fmt.Errorf("no common ancestor within %d blocks", maxDepth)
+	}
+	return a, nil
+}
+
+// ReorgDepth returns the number of canonical blocks that would be rolled back if
+// the chain switched to newHead, i.e. the distance from the current head to its
+// common ancestor with newHead. Zero is returned if newHead extends the current
+// head. The ancestors of newHead must be known.
+func (bc *BlockChain) ReorgDepth(newHead *types.Header) (uint64, error) {
+	head := bc.CurrentBlock()
+	ancestor, err := bc.FindCommonAncestor(head, newHead)
+	if err != nil {
+		return 0, err
+	}
+	return head.Number.Uint64() - ancestor.Number.Uint64(), nil
+}
+
+// GetTransactionLookup retrieves the lookup along with the transaction
+// itself associate with the given transaction hash.
+//
+// An error will be returned if the transaction is not found, and background
+// indexing for transactions is still in progress. The transaction might be
+// reachable shortly once it's indexed.
+//
+// A null will be returned in the transaction is not found and background
+// transaction indexing is already finished. The transaction is not existent
+// from the node's perspective.
+func (bc *BlockChain) GetTransactionLookup(hash common.Hash) (*rawdb.LegacyTxLookupEntry, *types.Transaction, error) {
+	bc.txLookupLock.RLock()
+	defer bc.txLookupLock.RUnlock()
+
+	// Short circuit if the txlookup already in the cache, retrieve otherwise
+	if item, exist := bc.txLookupCache.Get(hash); exist {
+		return item.lookup, item.transaction, nil
+	}
+	tx, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(bc.db, hash)
+	if tx == nil {
+		progress, err := bc.TxIndexProgress()
+		if err != nil {
+			// No error is returned if the transaction indexing progress is unreachable
+			// due to unexpected internal errors. In such cases, it is impossible to
+			// determine whether the transaction does not exist or has simply not been
+			// indexed yet without a progress marker.
+			//
+			// In such scenarios, the transaction is treated as unreachable, though
+			// this is clearly an unintended and unexpected situation.
+			return nil, nil, nil
+		}
+		// The transaction indexing is not finished yet, returning an
+		// error to explicitly indicate it.
+		if !progress.Done() {
+			return nil, nil, errors.New("transaction indexing still in progress")
+		}
+		// The transaction is already indexed, the transaction is either
+		// not existent or not in the range of index, returning null.
+		return nil, nil, nil
+	}
+	lookup := &rawdb.LegacyTxLookupEntry{
+		BlockHash:  blockHash,
+		BlockIndex: blockNumber,
+		Index:      txIndex,
+	}
+	bc.txLookupCache.Add(hash, txLookup{
+		lookup:      lookup,
+		transaction: tx,
+	})
+	return lookup, tx, nil
+}
+
+// GetTransactionLookups is the batched version of GetTransactionLookup. The
+// lookup lock is acquired only once for the entire batch, cached entries are
+// served first and the rest are read from the database. The returned slices
+// are index-aligned with the given hashes and each entry follows the semantics
+// of GetTransactionLookup.
+func (bc *BlockChain) GetTransactionLookups(hashes []common.Hash) ([]*rawdb.LegacyTxLookupEntry, []*types.Transaction, []error) {
+	var (
+		lookups = make([]*rawdb.LegacyTxLookupEntry, len(hashes))
+		txs     = make([]*types.Transaction, len(hashes))
+		errs    = make([]error, len(hashes))
+		missing []int
+	)
+	bc.txLookupLock.RLock()
+	defer bc.txLookupLock.RUnlock()
+
+	for i, hash := range hashes {
+		if item, exist := bc.txLookupCache.Get(hash); exist {
+			lookups[i], txs[i] = item.lookup, item.transaction
+			continue
+		}
+		missing = append(missing, i)
+	}
+	// Resolve the cache misses from the database. The indexing progress is only
+	// retrieved once, if any of the transactions turns out to be unknown.
+	var (
+		progress    TxIndexProgress
+		progressErr error
+		progressSet bool
+	)
+	for _, i := range missing {
+		tx, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(bc.db, hashes[i])
+		if tx == nil {
+			if !progressSet {
+				progress, progressErr = bc.TxIndexProgress()
+				progressSet = true
+			}
+			// Same as GetTransactionLookup: unknown transactions are an error
+			// only if indexing is reachable and still in progress.
+			if progressErr == nil && !progress.Done() {
+				errs[i] = errors.New("transaction indexing still in progress")
+			}
+			continue
+		}
+		lookups[i] = &rawdb.LegacyTxLookupEntry{
+			BlockHash:  blockHash,
+			BlockIndex: blockNumber,
+			Index:      txIndex,
+		}
+		txs[i] = tx
+		bc.txLookupCache.Add(hashes[i], txLookup{
+			lookup:      lookups[i],
+			transaction: tx,
+		})
+	}
+	return lookups, txs, errs
+}
+
+// GetTransactionReceipt retrieves the receipt of the transaction with the given
+// hash along with its lookup entry. The lookup follows the same caching and
+// error semantics as GetTransactionLookup: an error is returned if the
+// transaction is not found while indexing is still in progress, and nil is
+// returned if the transaction is not existent.
+func (bc *BlockChain) GetTransactionReceipt(hash common.Hash) (*types.Receipt, *rawdb.LegacyTxLookupEntry, error) {
+	lookup, _, err := bc.GetTransactionLookup(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lookup == nil {
+		return nil, nil, nil
+	}
+	receipts := bc.GetReceiptsByHash(lookup.BlockHash)
+	if lookup.Index >= uint64(len(receipts)) {
+		return nil, lookup, fmt.Errorf("receipt of transaction %x not found", hash)
+	}
+	return receipts[lookup.Index], lookup, nil
+}
+
+// ValidatorReward is the net reward collected by the validator of a block.
+type ValidatorReward struct {
+	Number    uint64
+	Hash      common.Hash
+	Validator common.Address
+	Reward    *big.Int
+}
+
+// blockReward computes the net reward collected by the producer of a block from
+// the transactions included in it: the effective tips on top of the base fee,
+// plus the blob fees under Parlia.
+func (bc *BlockChain) blockReward(header *types.Header, receipts types.Receipts) *big.Int {
+	var (
+		reward    = new(big.Int)
+		blobFees  = bc.chainConfig.Parlia != nil && bc.chainConfig.IsCancun(header.Number, header.Time)
+		tip, used = new(big.Int), new(big.Int)
+	)
+	for _, receipt := range receipts {
+		if receipt.EffectiveGasPrice != nil {
+			tip.Set(receipt.EffectiveGasPrice)
+			if header.BaseFee != nil {
+				tip.Sub(tip, header.BaseFee)
+			}
+			reward.Add(reward, tip.Mul(tip, used.SetUint64(receipt.GasUsed)))
+		}
+		if blobFees && receipt.BlobGasPrice != nil {
+			reward.Add(reward, tip.Mul(receipt.BlobGasPrice, used.SetUint64(receipt.BlobGasUsed)))
+		}
+	}
+	return reward
+}
+
+// ValidatorRewardSeries computes the net reward and the producing validator of
+// each canonical block in the range [start, end]. The receipts of the blocks
+// are retrieved concurrently.
+func (bc *BlockChain) ValidatorRewardSeries(start, end uint64) ([]ValidatorReward, error) {
+	if start > end {
+		return nil, fmt.Errorf("invalid block range: start %d > end %d", start, end)
+	}
+	if end-start >= maxBlockRangeQuery {
+		return nil, fmt.Errorf("block range too large: %d > %d", end-start+1, maxBlockRangeQuery)
+	}
+	var (
+		rewards = make([]ValidatorReward, end-start+1)
+		workers errgroup.Group
+	)
+	workers.SetLimit(runtime.NumCPU())
+	for i := range rewards {
+		number := start + uint64(i)
+		workers.Go(func() error {
+			hash := bc.GetCanonicalHash(number)
+			if hash == (common.Hash{}) {
+				return fmt.Errorf("block #%d not found", number)
+			}
+			header := bc.GetHeader(hash, number)
+			if header == nil {
+				return fmt.Errorf("header #%d [%x..] not found", number, hash[:4])
+			}
+			validator, err := bc.engine.Author(header)
+			if err != nil {
+				return err
+			}
+			receipts := bc.GetReceiptsByHash(hash)
+			if receipts == nil && header.GasUsed > 0 {
+				return fmt.Errorf("receipts #%d [%x..] not found", number, hash[:4])
+			}
+			rewards[i] = ValidatorReward{
+				Number:    number,
+				Hash:      hash,
+				Validator: validator,
+				Reward:    bc.blockReward(header, receipts),
+			}
+			return nil
+		})
+	}
+	if err := workers.Wait(); err != nil {
+		return nil, err
+	}
+	return rewards, nil
+}
+
+// GetSupplyDelta computes the net amount of native currency removed from the
+// supply by the canonical block with the given number, i.e. the burnt fees.
+// Block rewards minted by other consensus engines (e.g. ethash) are not
+// accounted for.
+//
+// Under Parlia no coins are minted by block production, and blob fees are
+// paid to the system contract instead of being burnt, so only the base fee is
+// accounted as burnt. Burns carried out by the system contracts themselves are
+// not included.
+func (bc *BlockChain) GetSupplyDelta(number uint64) (*big.Int, error) {
+	hash := bc.GetCanonicalHash(number)
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	header := bc.GetHeader(hash, number)
+	if header == nil {
+		return nil, fmt.Errorf("header #%d [%x..] not found", number, hash[:4])
+	}
+	receipts := bc.GetReceiptsByHash(hash)
+	if receipts == nil && header.GasUsed > 0 {
+		return nil, fmt.Errorf("receipts #%d [%x..] not found", number, hash[:4])
+	}
+	var (
+		burnt    = new(big.Int)
+		blobFees = bc.chainConfig.Parlia == nil && bc.chainConfig.IsCancun(header.Number, header.Time)
+		gasUsed  uint64
+	)
+	for _, receipt := range receipts {
+		gasUsed += receipt.GasUsed
+		if blobFees && receipt.BlobGasPrice != nil {
+			burnt.Add(burnt, new(big.Int).Mul(receipt.BlobGasPrice, new(big.Int).SetUint64(receipt.BlobGasUsed)))
+		}
+	}
+	if header.BaseFee != nil {
+		burnt.Add(burnt, new(big.Int).Mul(header.BaseFee, new(big.Int).SetUint64(gasUsed)))
+	}
+	return burnt, nil
+}
+
+// GetTd retrieves a block's total difficulty in the canonical chain from the
+// database by hash and number, caching it if found.
+func (bc *BlockChain) GetTd(hash common.Hash, number uint64) *big.Int {
+	return bc.hc.GetTd(hash, number)
+}
+
+// GetHeaderAndTd retrieves a block header along with its total difficulty from
+// the database by hash and number, caching both if found. Nils are returned if
+// the header is missing.
+func (bc *BlockChain) GetHeaderAndTd(hash common.Hash, number uint64) (*types.Header, *big.Int) {
+	header := bc.hc.GetHeader(hash, number)
+	if header == nil {
+		return nil, nil
+	}
+	return header, bc.hc.GetTd(hash, number)
+}
+
+// GetTdByNumber retrieves the total difficulty of the canonical block with the
+// given number, caching it if found. Nil is returned if the block is unknown.
+func (bc *BlockChain) GetTdByNumber(number uint64) *big.Int {
+	hash := bc.hc.GetCanonicalHash(number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return bc.hc.GetTd(hash, number)
+}
+
+// CurrentTd retrieves the total difficulty of the current head block, loading
+// the head only once so it cannot change between reading it and its difficulty.
+// Nil is returned if the total difficulty is not available.
+//
+// The value reflects the total difficulty stored alongside the canonical chain.
+// Under PoSA every block carries a difficulty of 1 or 2 depending on whether it
+// was sealed in turn, so it is not a measure of work; after the merge on beacon
+// chains it stays constant.
+func (bc *BlockChain) CurrentTd() *big.Int {
+	head := bc.CurrentBlock()
+	if head == nil {
+		return nil
+	}
+	return bc.hc.GetTd(head.Hash(), head.Number.Uint64())
+}
+
+// HasState checks if state trie is fully present in the database or not.
+func (bc *BlockChain) HasState(hash common.Hash) bool {
+	if bc.NoTries() {
+		if bc.snaps != nil {
+			return bc.snaps.Snapshot(hash) != nil
+		}
+		// snaps is nil when the blockchain creates
+		found, err := snapshot.PreCheckSnapshot(bc.db, hash)
+		if err != nil {
+			log.Warn("Check HasState in NoTries mode failed", "root", hash, "err", err)
+			return false
+		}
+		return found
+	}
+	_, err := bc.statedb.OpenTrie(hash)
+	return err == nil
+}
+
+// HasBlockAndState checks if a block and associated state trie is fully present
+// in the database or not, caching it if present.
+func (bc *BlockChain) HasBlockAndState(hash common.Hash, number uint64) bool {
+	// Check first that the block itself is known
+	block := bc.GetBlock(hash, number)
+	if block == nil {
+		return false
+	}
+	return bc.HasState(block.Root())
+}
+
+// IsStatePersisted reports whether the state identified by root has been
+// flushed to disk, as opposed to only residing in the in-memory layers of the
+// trie database which would be lost on an unclean shutdown. Under the path
+// scheme only the state of the disk layer is treated as persisted. An error is
+// returned if the state is not known at all.
+func (bc *BlockChain) IsStatePersisted(root common.Hash) (bool, error) {
+	if !bc.HasState(root) {
+		return false, fmt.Errorf("state %x not found", root)
+	}
+	diskdb := bc.triedb.Disk()
+	if bc.triedb.Scheme() == rawdb.PathScheme {
+		_, stored := rawdb.ReadAccountTrieNodeAndHash(diskdb, nil)
+		return stored == root, nil
+	}
+	return rawdb.HasLegacyTrieNode(diskdb, root), nil
+}
+
+// stateRecoverable checks if the specified state is recoverable.
+// Note, this function assumes the state is not present, because
+// state is not treated as recoverable if it's available, thus
+// false will be returned in this case.
+func (bc *BlockChain) stateRecoverable(root common.Hash) bool {
+	if bc.triedb.Scheme() == rawdb.HashScheme {
+		return false
+	}
+	result, _ := bc.triedb.Recoverable(root)
+	return result
+}
+
+// StateRecoverable reports whether the state identified by root, assumed to be
+// missing, can be regenerated from the state histories. It's always false for
+// the hash scheme.
+func (bc *BlockChain) StateRecoverable(root common.Hash) bool {
+	return bc.stateRecoverable(root)
+}
+
+// StateAvailability reports whether the state identified by root is present,
+// and if not, whether it's recoverable from the state histories. A state that
+// is neither available nor recoverable is gone for good.
+func (bc *BlockChain) StateAvailability(root common.Hash) (available bool, recoverable bool) {
+	if bc.HasState(root) {
+		return true, false
+	}
+	return false, bc.stateRecoverable(root)
+}
+
+// ContractCodeWithPrefix retrieves a blob of data associated with a contract
+// hash either from ephemeral in-memory cache, or from persistent storage.
+//
+// The owning account is not specified, use ContractCode if it's known.
+func (bc *BlockChain) ContractCodeWithPrefix(hash common.Hash) []byte {
+	// TODO(rjl493456442) The associated account address is also required
+	// in Verkle scheme. Fix it once snap-sync is supported for Verkle.
+	return bc.ContractCode(common.Address{}, hash)
+}
+
+// ContractCode retrieves a blob of data associated with a contract hash owned
+// by the given account, either from ephemeral in-memory cache, or from persistent
+// storage. The account address is required by the Verkle scheme.
+func (bc *BlockChain) ContractCode(addr common.Address, hash common.Hash) []byte {
+	return bc.statedb.ContractCodeWithPrefix(addr, hash)
+}
+
+// WarmContractCode loads the contract codes with the given hashes into the code
+// cache, so that subsequent executions don't have to hit the disk. Unknown codes
+// are silently ignored.
+func (bc *BlockChain) WarmContractCode(hashes []common.Hash) {
+	bc.WarmContractCodeContext(context.Background(), hashes)
+}
+
+// WarmContractCodeContext is like WarmContractCode, but aborts scheduling any
+// further loads once the context is cancelled, returning the context's error.
+func (bc *BlockChain) WarmContractCodeContext(ctx context.Context, hashes []common.Hash) error {
+	var (
+		seen    = make(map[common.Hash]struct{}, len(hashes))
+		workers errgroup.Group
+	)
+	workers.SetLimit(runtime.NumCPU())
+	for _, hash := range hashes {
+		if _, ok := seen[hash]; ok || hash == types.EmptyCodeHash {
+			continue
+		}
+		seen[hash] = struct{}{}
+
+		if ctx.Err() != nil {
+			break
+		}
+		workers.Go(func() error {
+			if ctx.Err() == nil {
+				bc.ContractCodeWithPrefix(hash)
+			}
+			return nil
+		})
+	}
+	workers.Wait()
+	return ctx.Err()
+}
+
+// ContractCodeSize retrieves the size of the contract code associated with the
+// given code hash. The size is served from a dedicated cache if possible, so
+// the code blob is only read on a cache miss.
+func (bc *BlockChain) ContractCodeSize(hash common.Hash) (int, error) {
+	if hash == types.EmptyCodeHash {
+		return 0, nil
+	}
+	size := bc.statedb.ContractCodeSizeWithPrefix(common.Address{}, hash)
+	if size == 0 {
+		return 0, fmt.Errorf("contract code %x not found", hash)
+	}
+	return size, nil
+}
+
+// State returns a new mutable state based on the current HEAD block.
+func (bc *BlockChain) State() (*state.StateDB, error) {
+	return bc.StateAt(bc.CurrentBlock().Root)
+}
+
+// PrefetchHeadState opens the state of the current head and reads the coinbase
+// account through it, pulling the head layer of the snapshot (or the top trie
+// nodes) into the caches ahead of block production. Repeated calls for the
+// same head are no-ops. An error is returned if the head state is unavailable.
+func (bc *BlockChain) PrefetchHeadState() error {
+	head := bc.CurrentBlock()
+	if root := bc.prefetchedRoot.Load(); root != nil && *root == head.Root {
+		return nil
+	}
+	statedb, err := bc.StateAt(head.Root)
+	if err != nil {
+		return err
+	}
+	statedb.GetBalance(head.Coinbase)
+	if err := statedb.Error(); err != nil {
+		return err
+	}
+	root := head.Root
+	bc.prefetchedRoot.Store(&root)
+	return nil
+}
+
+// StateAt returns a new mutable state based on a particular point in time.
+func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	return bc.StateAtContext(context.Background(), root)
+}
+
+// StateAtContext returns a new mutable state based on a particular point in
+// time, like StateAt, but gives up once the context is cancelled. The context is
+// checked between the steps of opening the state, a step already in progress
+// (e.g. a slow database read) runs to completion before the cancellation is
+// noticed. No background work is left behind.
+func (bc *BlockChain) StateAtContext(ctx context.Context, root common.Hash) (*state.StateDB, error) {
+	stateDb, err := state.NewWithContext(ctx, root, bc.statedb)
+	if err != nil {
+		return nil, err
+	}
+
+	// If there's no trie and the specified snapshot is not available, getting
+	// any state will by default return nil.
+	// Instead of that, it will be more useful to return an error to indicate
+	// the state is not available.
+	if stateDb.NoTrie() && stateDb.GetSnap() == nil {
+		return nil, errors.New("state is not available")
+	}
+
+	return stateDb, err
+}
+
+// StateAtBlock returns a new mutable state based on the post-state of the given
+// block. See StateAtHeader for the handling of missing states.
+func (bc *BlockChain) StateAtBlock(block *types.Block) (*state.StateDB, error) {
+	if block == nil {
+		return nil, errors.New("block is nil")
+	}
+	return bc.StateAtHeader(block.Header())
+}
+
+// StateAtHeader returns a new mutable state based on the post-state of the block
+// with the given header.
+//
+// No recovery is attempted if the state is missing. The path scheme can restore
+// pruned states from its state histories, but only by rewinding the disk layer
+// and thus the live chain head, which a read accessor must never do. Use
+// StateRecoverable to tell a recoverable state apart from one that is gone.
+func (bc *BlockChain) StateAtHeader(header *types.Header) (*state.StateDB, error) {
+	if header == nil {
+		return nil, errors.New("header is nil")
+	}
+	return bc.StateAt(header.Root)
+}
+
+// RegenerateState returns the state with the given root, re-executing blocks to
+// regenerate it if it has been pruned. The canonical block with the root is
+// looked up by walking back from the head, then the closest available state
+// among its up to maxReplay ancestors is located and the blocks on top of it
+// are processed.
+//
+// The regeneration happens in an ephemeral trie database without a clean cache,
+// so the live one is never modified and the regenerated nodes are released with
+// the returned state. Only the hash scheme is supported: a path scheme database
+// keeps a single persistent state and its pruned states can only be restored by
+// rewinding the chain, see StateRecoverable.
+func (bc *BlockChain) RegenerateState(root common.Hash, maxReplay uint64) (*state.StateDB, error) {
+	if statedb, err := bc.StateAt(root); err == nil {
+		return statedb, nil
+	}
+	if bc.triedb.Scheme() == rawdb.PathScheme {
+		return nil, errors.New("state regeneration is not supported in path scheme, pruned states can only be recovered by rewinding the chain")
+	}
+	// Locate the canonical block with the requested state
+	var header *types.Header
+	for number := bc.CurrentBlock().Number.Uint64(); header == nil; number-- {
+		if current := bc.GetHeaderByNumber(number); current != nil && current.Root == root {
+			header = current
+		}
+		if number == 0 {
+			break
+		}
+	}
+	if header == nil {
+		return nil, fmt.Errorf("no canonical block with state root %x", root)
+	}
+	// Find the closest ancestor with an available state in an ephemeral database
+	var (
+		tdb      = triedb.NewDatabase(bc.db, triedb.HashDefaults)
+		database = state.NewDatabase(tdb, nil)
+		number   = header.Number.Uint64()
+		current  = header
+		parent   common.Hash
+		statedb  *state.StateDB
+		err      error
+	)
+	for i := uint64(0); i < maxReplay; i++ {
+		if current.Number.Sign() == 0 {
+			return nil, errors.New("genesis state is missing")
+		}
+		number := current.Number.Uint64() - 1
+		if current = bc.GetHeader(current.ParentHash, number); current == nil {
+			return nil, fmt.Errorf("header #%d not found", number)
+		}
+		if statedb, err = state.New(current.Root, database); err == nil {
+			break
+		}
+	}
+	if statedb == nil {
+		return nil, fmt.Errorf("no available state within %d blocks of #%d", maxReplay, number)
+	}
+	// Re-execute the blocks on top of the available state
+	for next := current.Number.Uint64() + 1; next <= number; next++ {
+		block := bc.GetBlockByNumber(next)
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", next)
+		}
+		statedb.SetExpectedStateRoot(block.Root())
+		if _, err := bc.processor.Process(block, statedb, vm.Config{}); err != nil {
+			return nil, fmt.Errorf("processing block #%d failed: %v", next, err)
+		}
+		committed, _, err := statedb.Commit(next, bc.chainConfig.IsEIP158(block.Number()), bc.chainConfig.IsCancun(block.Number(), block.Time()))
+		if err != nil {
+			return nil, fmt.Errorf("state commit of block #%d failed: %v", next, err)
+		}
+		if committed != block.Root() {
+			return nil, fmt.Errorf("regenerated state of block #%d mismatch: have %x, want %x", next, committed, block.Root())
+		}
+		if statedb, err = state.New(committed, database); err != nil {
+			return nil, fmt.Errorf("state reset after block #%d failed: %v", next, err)
+		}
+		// Hold the new state and drop the previous one to bound memory usage
+		tdb.Reference(committed, common.Hash{})
+		if parent != (common.Hash{}) {
+			tdb.Dereference(parent)
+		}
+		parent = committed
+	}
+	return statedb, nil
+}
+
+// OldestAvailableState returns the root and the block number of the oldest state
+// that can be accessed, directly or by recovering it from the state histories.
+// In path scheme this is the state preceding the earliest retained history, or
+// the head state if there are none. In hash scheme only the head state is
+// reported, as the retention of older states is not tracked. An error is
+// returned if no state is available at all.
+func (bc *BlockChain) OldestAvailableState() (common.Hash, uint64, error) {
+	if bc.triedb.Scheme() == rawdb.PathScheme {
+		if first, _, err := bc.triedb.HistoryRange(); err == nil && first > 0 {
+			if header := bc.GetHeaderByNumber(first - 1); header != nil && (bc.HasState(header.Root) || bc.stateRecoverable(header.Root)) {
+				return header.Root, first - 1, nil
+			}
+		}
+	}
+	head := bc.CurrentBlock()
+	if !bc.HasState(head.Root) {
+		return common.Hash{}, 0, fmt.Errorf("head state #%d [%x..] not available", head.Number, head.Root[:4])
+	}
+	return head.Root, head.Number.Uint64(), nil
+}
+
+// StateAtWithReuse returns a mutable state based on a particular point in time,
+// like StateAt. If prev is backed by the same state database, it is rebased
+// onto the given root instead of allocating a new state.
+//
+// The returned state may alias the internal buffers of prev, so callers must
+// be finished with prev before calling this method and must not use it after.
+func (bc *BlockChain) StateAtWithReuse(root common.Hash, prev *state.StateDB) (*state.StateDB, error) {
+	if prev == nil || prev.Database() != state.Database(bc.statedb) {
+		return bc.StateAt(root)
+	}
+	if err := prev.Reset(root); err != nil {
+		return nil, err
+	}
+	// Mirror the availability check of StateAt, see there
+	if prev.NoTrie() && prev.GetSnap() == nil {
+		return nil, errors.New("state is not available")
+	}
+	return prev, nil
+}
+
+// AccountsExist reports for each of the given addresses whether the account
+// exists in the state identified by root. The snapshot layer is used if it
+// covers the requested state, otherwise (or if the snapshot is unusable, e.g.
+// still being generated) the state is read via the trie. The returned slice is
+// index-aligned with the given addresses.
+func (bc *BlockChain) AccountsExist(root common.Hash, addrs []common.Address) ([]bool, error) {
+	exists := make([]bool, len(addrs))
+	if bc.snaps != nil {
+		if snap := bc.snaps.Snapshot(root); snap != nil {
+			var err error
+			for i, addr := range addrs {
+				var account *types.SlimAccount
+				if account, err = snap.Account(crypto.Keccak256Hash(addr.Bytes())); err != nil {
+					log.Debug("Snapshot account lookup failed, falling back to trie", "root", root, "err", err)
+					break
+				}
+				exists[i] = account != nil
+			}
+			if err == nil {
+				return exists, nil
+			}
+		}
+	}
+	statedb, err := state.New(root, bc.statedb)
+	if err != nil {
+		return nil, err
+	}
+	for i, addr := range addrs {
+		exists[i] = statedb.Exist(addr)
+	}
+	if err := statedb.Error(); err != nil {
+		return nil, err
+	}
+	return exists, nil
+}
+
+// GetAccountWithCode retrieves the account with the given address along with
+// its contract code from the state identified by root, both read through the
+// same state reader. Nil is returned for non-existent accounts, and nil code
+// for accounts without code.
+func (bc *BlockChain) GetAccountWithCode(root common.Hash, addr common.Address) (*types.StateAccount, []byte, error) {
+	reader, err := bc.statedb.Reader(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	account, err := reader.Account(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if account == nil {
+		return nil, nil, nil
+	}
+	codeHash := common.BytesToHash(account.CodeHash)
+	if codeHash == types.EmptyCodeHash {
+		return account, nil, nil
+	}
+	code, err := reader.Code(addr, codeHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, code, nil
+}
+
+// BalanceAt returns the balance of the given account in the state identified by
+// root, or an error if that state is not available.
+func (bc *BlockChain) BalanceAt(addr common.Address, root common.Hash) (*big.Int, error) {
+	statedb, err := bc.StateAt(root)
+	if err != nil {
+		return nil, err
+	}
+	balance := statedb.GetBalance(addr)
+	if err := statedb.Error(); err != nil {
+		return nil, err
+	}
+	return balance.ToBig(), nil
+}
+
+// NonceAt returns the nonce of the given account in the state identified by
+// root, or an error if that state is not available.
+func (bc *BlockChain) NonceAt(addr common.Address, root common.Hash) (uint64, error) {
+	statedb, err := bc.StateAt(root)
+	if err != nil {
+		return 0, err
+	}
+	nonce := statedb.GetNonce(addr)
+	if err := statedb.Error(); err != nil {
+		return 0, err
+	}
+	return nonce, nil
+}
+
+// StorageRoot returns the storage trie root of the given account in the state
+// identified by stateRoot. The empty root is returned for accounts without
+// storage, including missing ones.
+func (bc *BlockChain) StorageRoot(addr common.Address, stateRoot common.Hash) (common.Hash, error) {
+	statedb, err := bc.StateAt(stateRoot)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	root := statedb.GetStorageRoot(addr)
+	if err := statedb.Error(); err != nil {
+		return common.Hash{}, err
+	}
+	if root == (common.Hash{}) {
+		return types.EmptyRootHash, nil
+	}
+	return root, nil
+}
+
+// ForEachStorage iterates over the storage slots of the given account in the
+// state identified by root, in the order of the hashed slot keys in the storage
+// trie, until fn returns false. The values are passed RLP-decoded. Keys are the
+// original slot keys if their preimages are known, the hashed keys otherwise.
+func (bc *BlockChain) ForEachStorage(addr common.Address, root common.Hash, fn func(key, value common.Hash) bool) error {
+	statedb, err := bc.StateAt(root)
+	if err != nil {
+		return err
+	}
+	storageRoot := statedb.GetStorageRoot(addr)
+	if err := statedb.Error(); err != nil {
+		return err
+	}
+	if storageRoot == (common.Hash{}) || storageRoot == types.EmptyRootHash {
+		return nil
+	}
+	tr, err := bc.statedb.OpenStorageTrie(root, addr, storageRoot, nil)
+	if err != nil {
+		return err
+	}
+	trieIt, err := tr.NodeIterator(nil)
+	if err != nil {
+		return err
+	}
+	it := trie.NewIterator(trieIt)
+	for it.Next() {
+		key := tr.GetKey(it.Key)
+		if key == nil {
+			key = it.Key
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return err
+		}
+		if !fn(common.BytesToHash(key), common.BytesToHash(content)) {
+			return nil
+		}
+	}
+	return it.Err
+}
+
+// CodeHashesInBlock returns the code hashes of the contracts directly called by
+// the transactions of the block with the given hash, deduplicated and in order
+// of first appearance. The code is resolved in the state of the parent block,
+// which must be available. The block is not executed: contracts reached only
+// through internal calls and contracts created in the block are not included.
+func (bc *BlockChain) CodeHashesInBlock(hash common.Hash) ([]common.Hash, error) {
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	if block.NumberU64() == 0 {
+		return nil, nil
+	}
+	parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent #%d [%x..] not found", block.NumberU64()-1, block.ParentHash().Bytes()[:4])
+	}
+	reader, err := bc.statedb.Reader(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		hashes []common.Hash
+		seen   = make(map[common.Address]struct{})
+		known  = make(map[common.Hash]struct{})
+	)
+	for _, tx := range block.Transactions() {
+		to := tx.To()
+		if to == nil {
+			continue
+		}
+		if _, ok := seen[*to]; ok {
+			continue
+		}
+		seen[*to] = struct{}{}
+
+		account, err := reader.Account(*to)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			continue
+		}
+		codeHash := common.BytesToHash(account.CodeHash)
+		if codeHash == types.EmptyCodeHash {
+			continue
+		}
+		if _, ok := known[codeHash]; !ok {
+			known[codeHash] = struct{}{}
+			hashes = append(hashes, codeHash)
+		}
+	}
+	return hashes, nil
+}
+
+// StorageProof is the Merkle proof of a single storage slot.
+type StorageProof struct {
+	Key   common.Hash
+	Value common.Hash
+	Proof [][]byte // RLP-encoded trie nodes from the storage root to the slot
+}
+
+// AccountProof is the Merkle proof of an account and some of its storage slots.
+type AccountProof struct {
+	Address     common.Address
+	Balance     *big.Int
+	Nonce       uint64
+	CodeHash    common.Hash
+	StorageRoot common.Hash
+	Proof       [][]byte // RLP-encoded trie nodes from the state root to the account
+	Storage     []StorageProof
+}
+
+// proofNodes collects the trie nodes of a Merkle proof in order.
+type proofNodes [][]byte
+
+func (n *proofNodes) Put(key []byte, value []byte) error {
+	*n = append(*n, common.CopyBytes(value))
+	return nil
+}
+
+func (n *proofNodes) Delete(key []byte) error {
+	return errors.New("not supported")
+}
+
+// GetProof generates the Merkle proofs of the given account and storage slots in
+// the state identified by root. Slots of accounts without storage are reported
+// with zero values and empty proofs.
+func (bc *BlockChain) GetProof(addr common.Address, storageKeys []common.Hash, root common.Hash) (*AccountProof, error) {
+	statedb, err := bc.StateAt(root)
+	if err != nil {
+		return nil, err
+	}
+	result := &AccountProof{
+		Address:     addr,
+		Balance:     statedb.GetBalance(addr).ToBig(),
+		Nonce:       statedb.GetNonce(addr),
+		CodeHash:    statedb.GetCodeHash(addr),
+		StorageRoot: statedb.GetStorageRoot(addr),
+		Storage:     make([]StorageProof, len(storageKeys)),
+	}
+	if len(storageKeys) > 0 {
+		var storageTrie state.Trie
+		if result.StorageRoot != types.EmptyRootHash && result.StorageRoot != (common.Hash{}) {
+			if storageTrie, err = bc.statedb.OpenStorageTrie(root, addr, result.StorageRoot, nil); err != nil {
+				return nil, err
+			}
+		}
+		for i, key := range storageKeys {
+			result.Storage[i] = StorageProof{Key: key}
+			if storageTrie == nil {
+				continue
+			}
+			if err := storageTrie.Prove(crypto.Keccak256(key.Bytes()), (*proofNodes)(&result.Storage[i].Proof)); err != nil {
+				return nil, err
+			}
+			result.Storage[i].Value = statedb.GetState(addr, key)
+		}
+	}
+	tr, err := bc.statedb.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := tr.Prove(crypto.Keccak256(addr.Bytes()), (*proofNodes)(&result.Proof)); err != nil {
+		return nil, err
+	}
+	if err := statedb.Error(); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-// GetSidecarsByHash retrieves the sidecars for all transactions in a given block.
-func (bc *BlockChain) GetSidecarsByHash(hash common.Hash) types.BlobSidecars {
-	if sidecars, ok := bc.sidecarsCache.Get(hash); ok {
-		return sidecars
+// SnapshotAccounts retrieves up to max accounts from the snapshot of the given
+// state root in hash order, starting at the given account hash. The hash to
+// resume from is returned as a cursor, or the zero hash if the iteration is
+// exhausted. At most maxSnapshotAccounts accounts may be requested per page. An
+// error is returned if the snapshot is not available.
+func (bc *BlockChain) SnapshotAccounts(root common.Hash, start common.Hash, max int) ([]snapshot.Account, common.Hash, error) {
+	if max <= 0 {
+		return nil, common.Hash{}, fmt.Errorf("invalid account limit: %d", max)
 	}
-	number := rawdb.ReadHeaderNumber(bc.db, hash)
-	if number == nil {
-		return nil
+	if max > maxSnapshotAccounts {
+		return nil, common.Hash{}, fmt.Errorf("account limit too large: %d > %d", max, maxSnapshotAccounts)
 	}
-	sidecars := rawdb.ReadBlobSidecars(bc.db, hash, *number)
-	if sidecars == nil {
-		return nil
+	if bc.snaps == nil {
+		return nil, common.Hash{}, errors.New("snapshot is not enabled")
 	}
-	bc.sidecarsCache.Add(hash, sidecars)
-	return sidecars
+	if bc.snaps.Snapshot(root) == nil {
+		return nil, common.Hash{}, fmt.Errorf("snapshot %x not available", root)
+	}
+	it, err := bc.snaps.AccountIterator(root, start)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	defer it.Release()
+
+	var accounts []snapshot.Account
+	for it.Next() {
+		if len(accounts) >= max {
+			return accounts, it.Hash(), nil
+		}
+		account, err := types.FullAccount(it.Account())
+		if err != nil {
+			return nil, common.Hash{}, err
+		}
+		accounts = append(accounts, snapshot.Account{Hash: it.Hash(), Account: account})
+	}
+	if err := it.Error(); err != nil {
+		return nil, common.Hash{}, err
+	}
+	return accounts, common.Hash{}, nil
 }
 
-// GetUnclesInChain retrieves all the uncles from a given block backwards until
-// a specific distance is reached.
-func (bc *BlockChain) GetUnclesInChain(block *types.Block, length int) []*types.Header {
-	uncles := []*types.Header{}
-	for i := 0; block != nil && i < length; i++ {
-		uncles = append(uncles, block.Uncles()...)
-		block = bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+// SnapshotStatus summarizes the state of the snapshot: the root of its disk
+// layer, whether the disk layer is still being generated and the approximate
+// fraction of the account space already generated. An error is returned if
+// snapshots are disabled.
+func (bc *BlockChain) SnapshotStatus() (root common.Hash, generating bool, progress float64, err error) {
+	if bc.snaps == nil {
+		return common.Hash{}, false, 0, errors.New("snapshot is not enabled")
 	}
-	return uncles
+	generating, marker, err := bc.snaps.Generating()
+	if err != nil {
+		return common.Hash{}, false, 0, err
+	}
+	root = bc.snaps.DiskRoot()
+	if !generating {
+		return root, false, 1, nil
+	}
+	// The marker starts with the hash of the account being generated, so its
+	// leading bytes tell the fraction of the (uniform) hash space covered.
+	var prefix [8]byte
+	copy(prefix[:], marker)
+	return root, true, float64(binary.BigEndian.Uint64(prefix[:])) / math.Pow(2, 64), nil
 }
 
-// GetCanonicalHash returns the canonical hash for a given block number
-func (bc *BlockChain) GetCanonicalHash(number uint64) common.Hash {
-	return bc.hc.GetCanonicalHash(number)
+// StorageDiff is a storage slot changed between two states. The values are RLP
+// encoded as stored in the snapshot, nil if the slot is absent.
+type StorageDiff struct {
+	Hash   common.Hash
+	Before []byte
+	After  []byte
 }
 
-// GetAncestor retrieves the Nth ancestor of a given block. It assumes that either the given block or
-// a close ancestor of it is canonical. maxNonCanonical points to a downwards counter limiting the
-// number of blocks to be individually checked before we reach the canonical chain.
-//
-// Note: ancestor == 0 returns the same block, 1 returns its parent and so on.
-func (bc *BlockChain) GetAncestor(hash common.Hash, number, ancestor uint64, maxNonCanonical *uint64) (common.Hash, uint64) {
-	return bc.hc.GetAncestor(hash, number, ancestor, maxNonCanonical)
+// AccountDiff is an account changed between two states, along with its changed
+// storage slots. Before is nil for created accounts, After for deleted ones.
+type AccountDiff struct {
+	Hash    common.Hash
+	Before  *types.StateAccount
+	After   *types.StateAccount
+	Storage []StorageDiff
 }
 
-// GetTransactionLookup retrieves the lookup along with the transaction
-// itself associate with the given transaction hash.
-//
-// An error will be returned if the transaction is not found, and background
-// indexing for transactions is still in progress. The transaction might be
-// reachable shortly once it's indexed.
-//
-// A null will be returned in the transaction is not found and background
-// transaction indexing is already finished. The transaction is not existent
-// from the node's perspective.
-func (bc *BlockChain) GetTransactionLookup(hash common.Hash) (*rawdb.LegacyTxLookupEntry, *types.Transaction, error) {
-	bc.txLookupLock.RLock()
-	defer bc.txLookupLock.RUnlock()
+// StateDiffResult lists the accounts changed between two states, in hash order.
+type StateDiffResult struct {
+	Created []AccountDiff
+	Updated []AccountDiff
+	Deleted []AccountDiff
+}
 
-	// Short circuit if the txlookup already in the cache, retrieve otherwise
-	if item, exist := bc.txLookupCache.Get(hash); exist {
-		return item.lookup, item.transaction, nil
-	}
-	tx, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(bc.db, hash)
-	if tx == nil {
-		progress, err := bc.TxIndexProgress()
-		if err != nil {
-			// No error is returned if the transaction indexing progress is unreachable
-			// due to unexpected internal errors. In such cases, it is impossible to
-			// determine whether the transaction does not exist or has simply not been
-			// indexed yet without a progress marker.
-			//
-			// In such scenarios, the transaction is treated as unreachable, though
-			// this is clearly an unintended and unexpected situation.
-			return nil, nil, nil
+// StateDiff computes the accounts and storage slots changed between the states
+// identified by oldRoot and newRoot, based on their snapshots. An error is
+// returned if either snapshot is unavailable. See diffSnapshots for the cost of
+// the computation.
+func (bc *BlockChain) StateDiff(oldRoot, newRoot common.Hash) (*StateDiffResult, error) {
+	var diffs []AccountDiff
+	err := bc.diffSnapshots(oldRoot, newRoot, func(hash common.Hash, before, after []byte) error {
+		var (
+			diff = AccountDiff{Hash: hash}
+			err  error
+		)
+		if before != nil {
+			if diff.Before, err = types.FullAccount(before); err != nil {
+				return err
+			}
 		}
-		// The transaction indexing is not finished yet, returning an
-		// error to explicitly indicate it.
-		if !progress.Done() {
-			return nil, nil, errors.New("transaction indexing still in progress")
+		if after != nil {
+			if diff.After, err = types.FullAccount(after); err != nil {
+				return err
+			}
 		}
-		// The transaction is already indexed, the transaction is either
-		// not existent or not in the range of index, returning null.
-		return nil, nil, nil
+		diffs = append(diffs, diff)
+		return nil
+	}, func(_ common.Hash, hash common.Hash, before, after []byte) error {
+		diff := &diffs[len(diffs)-1]
+		diff.Storage = append(diff.Storage, StorageDiff{Hash: hash, Before: before, After: after})
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	lookup := &rawdb.LegacyTxLookupEntry{
-		BlockHash:  blockHash,
-		BlockIndex: blockNumber,
-		Index:      txIndex,
+	result := new(StateDiffResult)
+	for _, diff := range diffs {
+		switch {
+		case diff.Before == nil:
+			result.Created = append(result.Created, diff)
+		case diff.After == nil:
+			result.Deleted = append(result.Deleted, diff)
+		default:
+			result.Updated = append(result.Updated, diff)
+		}
 	}
-	bc.txLookupCache.Add(hash, txLookup{
-		lookup:      lookup,
-		transaction: tx,
-	})
-	return lookup, tx, nil
-}
-
-// GetTd retrieves a block's total difficulty in the canonical chain from the
-// database by hash and number, caching it if found.
-func (bc *BlockChain) GetTd(hash common.Hash, number uint64) *big.Int {
-	return bc.hc.GetTd(hash, number)
+	return result, nil
 }
 
-// HasState checks if state trie is fully present in the database or not.
-func (bc *BlockChain) HasState(hash common.Hash) bool {
-	if bc.NoTries() {
-		if bc.snaps != nil {
-			return bc.snaps.Snapshot(hash) != nil
+// StateSizeDelta computes the change in the number of accounts and storage slots
+// between the states identified by parentRoot and childRoot, based on their
+// snapshots. An error is returned if either snapshot is unavailable. For a block
+// and its parent, only the entries changed by the block are checked.
+func (bc *BlockChain) StateSizeDelta(parentRoot, childRoot common.Hash) (accountsAdded, slotsAdded int64, err error) {
+	err = bc.diffSnapshots(parentRoot, childRoot, func(_ common.Hash, before, after []byte) error {
+		switch {
+		case before == nil:
+			accountsAdded++
+		case after == nil:
+			accountsAdded--
 		}
-		// snaps is nil when the blockchain creates
-		found, err := snapshot.PreCheckSnapshot(bc.db, hash)
-		if err != nil {
-			log.Warn("Check HasState in NoTries mode failed", "root", hash, "err", err)
-			return false
+		return nil
+	}, func(_ common.Hash, _ common.Hash, before, after []byte) error {
+		switch {
+		case before == nil:
+			slotsAdded++
+		case after == nil:
+			slotsAdded--
 		}
-		return found
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
 	}
-	_, err := bc.statedb.OpenTrie(hash)
-	return err == nil
+	return accountsAdded, slotsAdded, nil
 }
 
-// HasBlockAndState checks if a block and associated state trie is fully present
-// in the database or not, caching it if present.
-func (bc *BlockChain) HasBlockAndState(hash common.Hash, number uint64) bool {
-	// Check first that the block itself is known
-	block := bc.GetBlock(hash, number)
-	if block == nil {
-		return false
-	}
-	return bc.HasState(block.Root())
+// snapshotLayer is implemented by the snapshot diff layers, listing the accounts
+// and storage slots changed by the layer in hash order.
+type snapshotLayer interface {
+	AccountList() []common.Hash
+	StorageList(account common.Hash) []common.Hash
 }
 
-// stateRecoverable checks if the specified state is recoverable.
-// Note, this function assumes the state is not present, because
-// state is not treated as recoverable if it's available, thus
-// false will be returned in this case.
-func (bc *BlockChain) stateRecoverable(root common.Hash) bool {
-	if bc.triedb.Scheme() == rawdb.HashScheme {
-		return false
+// diffSnapshots walks the accounts changed between the snapshots of oldRoot and
+// newRoot in hash order, invoking onAccount for each of them, followed by onSlot
+// for each of its changed storage slots. The values are in snapshot format, nil
+// if the entry is absent.
+//
+// If the new snapshot is a diff layer directly on top of the old one, e.g. the
+// states of a block and its parent, only the entries changed by the layer are
+// checked. Otherwise both snapshots are iterated in full, which is expensive.
+func (bc *BlockChain) diffSnapshots(oldRoot, newRoot common.Hash, onAccount func(hash common.Hash, before, after []byte) error, onSlot func(account common.Hash, hash common.Hash, before, after []byte) error) error {
+	if bc.snaps == nil {
+		return errors.New("snapshots are disabled")
 	}
-	result, _ := bc.triedb.Recoverable(root)
-	return result
+	oldSnap, newSnap := bc.snaps.Snapshot(oldRoot), bc.snaps.Snapshot(newRoot)
+	if oldSnap == nil {
+		return fmt.Errorf("snapshot %x not available", oldRoot)
+	}
+	if newSnap == nil {
+		return fmt.Errorf("snapshot %x not available", newRoot)
+	}
+	if layer, ok := newSnap.(snapshotLayer); ok {
+		if parent := newSnap.Parent(); parent != nil && parent.Root() == oldRoot {
+			return diffSnapshotLayer(oldSnap, newSnap, layer, onAccount, onSlot)
+		}
+	}
+	oldIt, err := bc.snaps.AccountIterator(oldRoot, common.Hash{})
+	if err != nil {
+		return err
+	}
+	defer oldIt.Release()
+
+	newIt, err := bc.snaps.AccountIterator(newRoot, common.Hash{})
+	if err != nil {
+		return err
+	}
+	defer newIt.Release()
+
+	return diffSnapshotIterators(oldIt, newIt, snapshot.AccountIterator.Account, func(hash common.Hash, before, after []byte) error {
+		if err := onAccount(hash, before, after); err != nil {
+			return err
+		}
+		// Only walk the storage if it was changed
+		oldStorage, err := snapshotStorageRoot(before)
+		if err != nil {
+			return err
+		}
+		newStorage, err := snapshotStorageRoot(after)
+		if err != nil {
+			return err
+		}
+		if oldStorage == newStorage {
+			return nil
+		}
+		oldIt, err := bc.snaps.StorageIterator(oldRoot, hash, common.Hash{})
+		if err != nil {
+			return err
+		}
+		defer oldIt.Release()
+
+		newIt, err := bc.snaps.StorageIterator(newRoot, hash, common.Hash{})
+		if err != nil {
+			return err
+		}
+		defer newIt.Release()
+
+		return diffSnapshotIterators(oldIt, newIt, snapshot.StorageIterator.Slot, func(slot common.Hash, before, after []byte) error {
+			return onSlot(hash, slot, before, after)
+		})
+	})
 }
 
-// ContractCodeWithPrefix retrieves a blob of data associated with a contract
-// hash either from ephemeral in-memory cache, or from persistent storage.
-func (bc *BlockChain) ContractCodeWithPrefix(hash common.Hash) []byte {
-	// TODO(rjl493456442) The associated account address is also required
-	// in Verkle scheme. Fix it once snap-sync is supported for Verkle.
-	return bc.statedb.ContractCodeWithPrefix(common.Address{}, hash)
+// diffSnapshotLayer walks the entries changed by the given diff layer on top of
+// its parent, in the same way as diffSnapshots.
+func diffSnapshotLayer(parent, child snapshot.Snapshot, layer snapshotLayer, onAccount func(hash common.Hash, before, after []byte) error, onSlot func(account common.Hash, hash common.Hash, before, after []byte) error) error {
+	for _, hash := range layer.AccountList() {
+		before, err := parent.AccountRLP(hash)
+		if err != nil {
+			return err
+		}
+		after, err := child.AccountRLP(hash)
+		if err != nil {
+			return err
+		}
+		// Storage changes always come with an account change
+		if bytes.Equal(before, after) {
+			continue
+		}
+		if err := onAccount(hash, snapshotValue(before), snapshotValue(after)); err != nil {
+			return err
+		}
+		for _, slot := range layer.StorageList(hash) {
+			before, err := parent.Storage(hash, slot)
+			if err != nil {
+				return err
+			}
+			after, err := child.Storage(hash, slot)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(before, after) {
+				continue
+			}
+			if err := onSlot(hash, slot, snapshotValue(before), snapshotValue(after)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-// State returns a new mutable state based on the current HEAD block.
-func (bc *BlockChain) State() (*state.StateDB, error) {
-	return bc.StateAt(bc.CurrentBlock().Root)
+// snapshotValue copies a value retrieved from a snapshot, which may be shared
+// with the snapshot, converting empty values to nil.
+func snapshotValue(blob []byte) []byte {
+	if len(blob) == 0 {
+		return nil
+	}
+	return common.CopyBytes(blob)
 }
 
-// StateAt returns a new mutable state based on a particular point in time.
-func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
-	stateDb, err := state.New(root, bc.statedb)
+// snapshotStorageRoot extracts the storage root of an account in snapshot format,
+// the empty root if the account is absent.
+func snapshotStorageRoot(data []byte) (common.Hash, error) {
+	if data == nil {
+		return types.EmptyRootHash, nil
+	}
+	account, err := types.FullAccount(data)
 	if err != nil {
-		return nil, err
+		return common.Hash{}, err
 	}
+	return account.Root, nil
+}
 
-	// If there's no trie and the specified snapshot is not available, getting
-	// any state will by default return nil.
-	// Instead of that, it will be more useful to return an error to indicate
-	// the state is not available.
-	if stateDb.NoTrie() && stateDb.GetSnap() == nil {
-		return nil, errors.New("state is not available")
+// diffSnapshotIterators walks two snapshot iterators side by side in hash order
+// and invokes fn for every entry whose value differs between them. A nil value
+// denotes an entry missing from the respective iterator.
+func diffSnapshotIterators[T snapshot.Iterator](oldIt, newIt T, value func(T) []byte, fn func(hash common.Hash, before, after []byte) error) error {
+	oldOk, newOk := oldIt.Next(), newIt.Next()
+	for oldOk || newOk {
+		var (
+			hash          common.Hash
+			before, after []byte
+		)
+		// The values are copied as the iterators may reuse their buffers
+		switch {
+		case !newOk || (oldOk && oldIt.Hash().Cmp(newIt.Hash()) < 0):
+			hash, before = oldIt.Hash(), common.CopyBytes(value(oldIt))
+			oldOk = oldIt.Next()
+		case !oldOk || oldIt.Hash().Cmp(newIt.Hash()) > 0:
+			hash, after = newIt.Hash(), common.CopyBytes(value(newIt))
+			newOk = newIt.Next()
+		default:
+			hash, before, after = oldIt.Hash(), common.CopyBytes(value(oldIt)), common.CopyBytes(value(newIt))
+			oldOk, newOk = oldIt.Next(), newIt.Next()
+		}
+		if bytes.Equal(before, after) {
+			continue
+		}
+		if err := fn(hash, before, after); err != nil {
+			return err
+		}
 	}
-
-	return stateDb, err
+	if err := oldIt.Error(); err != nil {
+		return err
+	}
+	return newIt.Error()
 }
 
 // Config retrieves the chain's fork configuration.
@@ -436,6 +3206,17 @@ func (bc *BlockChain) Config() *params.ChainConfig { return bc.chainConfig }
 // Engine retrieves the blockchain's consensus engine.
 func (bc *BlockChain) Engine() consensus.Engine { return bc.engine }
 
+// VerifyHeaderStandalone checks whether the given header conforms to the
+// consensus rules, without importing it. The parent must be known. Neither the
+// chain nor its caches are modified, though the engine may still cache the
+// intermediate data (e.g. validator snapshots) derived during verification.
+func (bc *BlockChain) VerifyHeaderStandalone(header *types.Header) error {
+	if header == nil {
+		return errors.New("header is nil")
+	}
+	return bc.engine.VerifyHeader(bc, header)
+}
+
 // Snapshots returns the blockchain snapshot tree.
 func (bc *BlockChain) Snapshots() *snapshot.Tree {
 	return bc.snaps
@@ -466,19 +3247,151 @@ func (bc *BlockChain) Genesis() *types.Block {
 	return bc.genesisBlock
 }
 
+// GenesisHash retrieves the hash of the chain's genesis block.
+func (bc *BlockChain) GenesisHash() common.Hash {
+	return bc.genesisHash
+}
+
 // GenesisHeader retrieves the chain's genesis block header.
 func (bc *BlockChain) GenesisHeader() *types.Header {
 	return bc.genesisBlock.Header()
 }
 
+// TimeRange returns the timestamps of the genesis block and the current head
+// block, i.e. the time span covered by the local chain.
+func (bc *BlockChain) TimeRange() (genesisTime, headTime uint64) {
+	return bc.genesisBlock.Time(), bc.CurrentBlock().Time
+}
+
 // TxIndexProgress returns the transaction indexing progress.
 func (bc *BlockChain) TxIndexProgress() (TxIndexProgress, error) {
 	if bc.txIndexer == nil {
-		return TxIndexProgress{}, errors.New("tx indexer is not enabled")
+		return TxIndexProgress{}, errTxIndexerDisabled
 	}
 	return bc.txIndexer.txIndexProgress()
 }
 
+// ImportQueueDepth returns the number of blocks queued for a later import. Block
+// insertion itself is synchronous, the only queue is the one of future blocks,
+// which arrived ahead of their timestamp or parent and are retried periodically.
+func (bc *BlockChain) ImportQueueDepth() int {
+	return bc.futureBlocks.Len()
+}
+
+// CacheStat contains the usage statistics of a single in-memory cache.
+type CacheStat struct {
+	Entries int                // Number of items currently held in the cache
+	Hits    uint64             // Number of successful lookups since startup
+	Misses  uint64             // Number of failed lookups since startup
+	Size    common.StorageSize // Approximate memory held by the cached items
+}
+
+// cacheStat gathers the usage statistics of the given cache, approximating its
+// memory footprint by summing the sizes of all the currently held items.
+func cacheStat[K comparable, V any](cache *lru.Cache[K, V], size func(V) common.StorageSize) CacheStat {
+	var (
+		hits, misses = cache.Stats()
+		stat         = CacheStat{Hits: hits, Misses: misses}
+	)
+	for _, key := range cache.Keys() {
+		// Items might be evicted concurrently, skip them silently
+		if item, ok := cache.Peek(key); ok {
+			stat.Entries++
+			stat.Size += size(item)
+		}
+	}
+	return stat
+}
+
+// CacheStats returns the usage statistics of the blockchain's in-memory caches,
+// keyed by cache name. Sizes are estimates and iterating the caches is linear
+// in their item counts, so this is meant for diagnostics, not hot paths.
+func (bc *BlockChain) CacheStats() map[string]CacheStat {
+	return map[string]CacheStat{
+		"body": cacheStat(bc.bodyCache, func(body *types.Body) common.StorageSize {
+			var size common.StorageSize
+			for _, tx := range body.Transactions {
+				size += common.StorageSize(tx.Size())
+			}
+			for _, uncle := range body.Uncles {
+				size += uncle.Size()
+			}
+			return size + common.StorageSize(types.Withdrawals(body.Withdrawals).Size())
+		}),
+		"bodyRLP": cacheStat(bc.bodyRLPCache, func(blob rlp.RawValue) common.StorageSize {
+			return common.StorageSize(len(blob))
+		}),
+		"receipts": cacheStat(bc.receiptsCache, func(receipts []*types.Receipt) common.StorageSize {
+			var size common.StorageSize
+			for _, receipt := range receipts {
+				size += receipt.Size()
+			}
+			return size
+		}),
+		"receiptsRLP": cacheStat(bc.receiptsRLPCache, func(blob rlp.RawValue) common.StorageSize {
+			return common.StorageSize(len(blob))
+		}),
+		"sidecars": cacheStat(bc.sidecarsCache, func(sidecars types.BlobSidecars) common.StorageSize {
+			var size common.StorageSize
+			for _, sidecar := range sidecars {
+				for i := range sidecar.Blobs {
+					size += common.StorageSize(len(sidecar.Blobs[i]))
+				}
+				for i := range sidecar.Commitments {
+					size += common.StorageSize(len(sidecar.Commitments[i]))
+				}
+				for i := range sidecar.Proofs {
+					size += common.StorageSize(len(sidecar.Proofs[i]))
+				}
+			}
+			return size
+		}),
+		"sidecarsRLP": cacheStat(bc.sidecarsRLPCache, func(blob rlp.RawValue) common.StorageSize {
+			return common.StorageSize(len(blob))
+		}),
+		"block": cacheStat(bc.blockCache, func(block *types.Block) common.StorageSize {
+			return common.StorageSize(block.Size())
+		}),
+		"canonHash": cacheStat(bc.canonHashCache, func(common.Hash) common.StorageSize {
+			return common.HashLength + 8
+		}),
+		"txLookup": cacheStat(bc.txLookupCache, func(lookup txLookup) common.StorageSize {
+			if lookup.transaction == nil {
+				return 0
+			}
+			return common.StorageSize(lookup.transaction.Size())
+		}),
+	}
+}
+
+// ResizeReceiptsCache changes the capacity of the receipts cache, retaining the
+// most recently used entries that fit.
+func (bc *BlockChain) ResizeReceiptsCache(newCap int) error {
+	return resizeCache(bc.receiptsCache, newCap)
+}
+
+// ResizeBlockCache changes the capacity of the block cache, retaining the most
+// recently used entries that fit.
+func (bc *BlockChain) ResizeBlockCache(newCap int) error {
+	return resizeCache(bc.blockCache, newCap)
+}
+
+// ResizeBodyCache changes the capacity of the body cache, retaining the most
+// recently used entries that fit.
+func (bc *BlockChain) ResizeBodyCache(newCap int) error {
+	return resizeCache(bc.bodyCache, newCap)
+}
+
+// resizeCache changes the capacity of the given cache, rejecting non-positive
+// capacities.
+func resizeCache[K comparable, V any](cache *lru.Cache[K, V], capacity int) error {
+	if capacity <= 0 {
+		return fmt.Errorf("invalid cache capacity: %d", capacity)
+	}
+	cache.Resize(capacity)
+	return nil
+}
+
 // TrieDB retrieves the low level trie database used for data storage.
 func (bc *BlockChain) TrieDB() *triedb.Database {
 	return bc.triedb
@@ -494,6 +3407,11 @@ func (bc *BlockChain) SubscribeRemovedLogsEvent(ch chan<- RemovedLogsEvent) even
 	return bc.scope.Track(bc.rmLogsFeed.Subscribe(ch))
 }
 
+// SubscribeReorgEvent registers a subscription of ReorgEvent.
+func (bc *BlockChain) SubscribeReorgEvent(ch chan<- ReorgEvent) event.Subscription {
+	return bc.scope.Track(bc.reorgFeed.Subscribe(ch))
+}
+
 // SubscribeChainEvent registers a subscription of ChainEvent.
 func (bc *BlockChain) SubscribeChainEvent(ch chan<- ChainEvent) event.Subscription {
 	return bc.scope.Track(bc.chainFeed.Subscribe(ch))
@@ -519,17 +3437,70 @@ func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscript
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
 }
 
+// SubscribeSidecarsEvent registers a subscription of SidecarsEvent.
+func (bc *BlockChain) SubscribeSidecarsEvent(ch chan<- SidecarsEvent) event.Subscription {
+	return bc.scope.Track(bc.sidecarsFeed.Subscribe(ch))
+}
+
 // SubscribeBlockProcessingEvent registers a subscription of bool where true means
 // block processing has started while false means it has stopped.
 func (bc *BlockChain) SubscribeBlockProcessingEvent(ch chan<- bool) event.Subscription {
 	return bc.scope.Track(bc.blockProcFeed.Subscribe(ch))
 }
 
+// SubscribeBlockProcessingErrorEvent registers a subscription of
+// BlockProcessingError, posted for every block rejected during import.
+func (bc *BlockChain) SubscribeBlockProcessingErrorEvent(ch chan<- BlockProcessingError) event.Subscription {
+	return bc.scope.Track(bc.blockProcErrFeed.Subscribe(ch))
+}
+
+// SubscribeTxIndexProgressEvent registers a subscription of TxIndexProgress,
+// emitted by the transaction indexer whenever it advances by a sizeable number
+// of blocks or finishes. If the indexer is not enabled, the subscription fails
+// immediately.
+func (bc *BlockChain) SubscribeTxIndexProgressEvent(ch chan<- TxIndexProgress) event.Subscription {
+	if bc.txIndexer == nil {
+		return event.NewSubscription(func(<-chan struct{}) error {
+			return errTxIndexerDisabled
+		})
+	}
+	return bc.scope.Track(bc.txIndexer.progressFeed.Subscribe(ch))
+}
+
+// SubscribeTxIndexedEvent registers a subscription of TxIndexedEvent, emitted
+// by the transaction indexer once the transactions of a block are retrievable
+// by hash, both for new canonical blocks and for backfilled ones. If the indexer
+// is not enabled, the subscription fails immediately.
+//
+// The events are sent from the indexing routine, which waits for every subscriber
+// to receive them: subscribers must use buffered channels and drain them promptly,
+// otherwise the indexing stalls.
+func (bc *BlockChain) SubscribeTxIndexedEvent(ch chan<- TxIndexedEvent) event.Subscription {
+	if bc.txIndexer == nil {
+		return event.NewSubscription(func(<-chan struct{}) error {
+			return errTxIndexerDisabled
+		})
+	}
+	return bc.scope.Track(bc.txIndexer.subscribeIndexed(ch))
+}
+
 // SubscribeFinalizedHeaderEvent registers a subscription of FinalizedHeaderEvent.
 func (bc *BlockChain) SubscribeFinalizedHeaderEvent(ch chan<- FinalizedHeaderEvent) event.Subscription {
 	return bc.scope.Track(bc.finalizedHeaderFeed.Subscribe(ch))
 }
 
+// SubscribePrunedBlockEvent registers a subscription of PrunedEvent, relayed from
+// the database freezer after each freeze cycle. No events are posted if the
+// database has no freezer.
+func (bc *BlockChain) SubscribePrunedBlockEvent(ch chan<- PrunedEvent) event.Subscription {
+	return bc.scope.Track(bc.prunedFeed.Subscribe(ch))
+}
+
+// SubscribeSafeHeaderEvent registers a subscription of SafeHeaderEvent.
+func (bc *BlockChain) SubscribeSafeHeaderEvent(ch chan<- SafeHeaderEvent) event.Subscription {
+	return bc.scope.Track(bc.safeHeaderFeed.Subscribe(ch))
+}
+
 // AncientTail retrieves the tail the ancients blocks
 func (bc *BlockChain) AncientTail() (uint64, error) {
 	tail, err := bc.db.BlockStore().Tail()
@@ -538,3 +3509,25 @@ func (bc *BlockChain) AncientTail() (uint64, error) {
 	}
 	return tail, nil
 }
+
+// AncientHeader retrieves the canonical header with the given number directly
+// from the freezer, bypassing the header chain and its caches. An error is
+// returned if the header has not been frozen yet or was pruned from the freezer.
+func (bc *BlockChain) AncientHeader(number uint64) (*types.Header, error) {
+	frozen, err := bc.db.BlockStore().Ancients()
+	if err != nil {
+		return nil, err
+	}
+	if number >= frozen {
+		return nil, fmt.Errorf("header #%d not in ancients, frozen %d", number, frozen)
+	}
+	data, err := bc.db.BlockStore().Ancient(rawdb.ChainFreezerHeaderTable, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ancient header #%d: %v", number, err)
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, fmt.Errorf("invalid ancient header #%d: %v", number, err)
+	}
+	return header, nil
+}
@@ -0,0 +1,2413 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	gomath "math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/misc/eip4844"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// newTestReaderGenesis returns the genesis of the reader tests, funding the
+// tester account.
+func newTestReaderGenesis() *Genesis {
+	return &Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  types.GenesisAlloc{testAddr: {Balance: big.NewInt(params.Ether)}},
+	}
+}
+
+// newTestMergedReaderGenesis is like newTestReaderGenesis, on a post-merge chain
+// config.
+func newTestMergedReaderGenesis() *Genesis {
+	config := *params.MergedTestChainConfig
+	return &Genesis{
+		Config: &config,
+		Alloc:  types.GenesisAlloc{testAddr: {Balance: big.NewInt(params.Ether)}},
+	}
+}
+
+// addTestWithdrawals adds i withdrawals to the block at index i.
+func addTestWithdrawals(i int, gen *BlockGen) {
+	for j := 0; j < i; j++ {
+		gen.AddWithdrawal(&types.Withdrawal{Validator: uint64(j), Address: common.Address{byte(i)}, Amount: uint64(j + 1)})
+	}
+}
+
+// addTestTransfer adds a value transfer from the tester account to the block,
+// paying the given priority fee.
+func addTestTransfer(gen *BlockGen, to common.Address, tip *big.Int) {
+	tx, _ := types.SignNewTx(testKey, gen.Signer(), &types.DynamicFeeTx{
+		ChainID:   gen.cm.config.ChainID,
+		Nonce:     gen.TxNonce(testAddr),
+		To:        &to,
+		Value:     big.NewInt(1000),
+		Gas:       params.TxGas,
+		GasFeeCap: new(big.Int).Add(gen.BaseFee(), tip),
+		GasTipCap: tip,
+	})
+	gen.AddTx(tx)
+}
+
+// addTestTransfers is the default block generator of the reader tests, adding
+// (i+1)%3 value transfers to the block at index i.
+func addTestTransfers(i int, gen *BlockGen) {
+	for j := 0; j < (i+1)%3; j++ {
+		addTestTransfer(gen, testAddr, common.Big0)
+	}
+}
+
+// addTestBlobTx adds a blob transaction from the tester account to the block,
+// along with its blob sidecar.
+func addTestBlobTx(gen *BlockGen) {
+	config := gen.cm.config
+	tx, sidecar := makeMockTx(config, gen.Signer(), testKey, gen.TxNonce(testAddr), gen.BaseFee().Uint64(), eip4844.CalcBlobFee(config, gen.HeadBlock()).Uint64(), true)
+	gen.AddTx(tx)
+	gen.AddBlobSidecar(&types.BlobSidecar{
+		BlobTxSidecar: *sidecar,
+		TxIndex:       uint64(len(gen.txs) - 1),
+		TxHash:        tx.Hash(),
+	})
+}
+
+// addTestBlobTransfers adds a value transfer followed by a blob transaction to
+// the blocks at even indices, leaving the others empty.
+func addTestBlobTransfers(i int, gen *BlockGen) {
+	if i%2 == 0 {
+		addTestTransfer(gen, testAddr, common.Big1)
+		addTestBlobTx(gen)
+	}
+}
+
+// newTestReaderChain creates a blockchain on top of the given genesis, with n
+// blocks generated by gen. The blocks are sealed by the beacon engine on top of
+// ethash, so post-merge genesis configs may carry withdrawals.
+func newTestReaderChain(t *testing.T, gspec *Genesis, n int, gen func(int, *BlockGen)) (*BlockChain, []*types.Block) {
+	_, blocks, _ := GenerateChainWithGenesis(gspec, beacon.New(ethash.NewFaker()), n, gen)
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, beacon.New(ethash.NewFaker()), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		chain.Stop()
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	return chain, blocks
+}
+
+func TestGetTransactionAt(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 6, addTestTransfers)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		for i, want := range block.Transactions() {
+			tx, err := chain.GetTransactionAt(block.NumberU64(), uint64(i))
+			if err != nil {
+				t.Fatalf("block %d tx %d: unexpected error: %v", block.NumberU64(), i, err)
+			}
+			if tx.Hash() != want.Hash() {
+				t.Fatalf("block %d tx %d: hash mismatch: have %x, want %x", block.NumberU64(), i, tx.Hash(), want.Hash())
+			}
+		}
+		if _, err := chain.GetTransactionAt(block.NumberU64(), uint64(len(block.Transactions()))); err == nil {
+			t.Fatalf("block %d: expected error for out-of-range index", block.NumberU64())
+		}
+	}
+	if _, err := chain.GetTransactionAt(uint64(len(blocks)+1), 0); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestGetWithdrawals(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestMergedReaderGenesis(), 4, addTestWithdrawals)
+	defer chain.Stop()
+
+	for _, cached := range []bool{false, true} {
+		for _, block := range blocks {
+			// Serve the withdrawals from the database or the body cache
+			if !cached {
+				chain.bodyCache.Purge()
+				chain.blockCache.Purge()
+			}
+			withdrawals, err := chain.GetWithdrawals(block.Hash())
+			if err != nil {
+				t.Fatalf("block %d: unexpected error: %v", block.NumberU64(), err)
+			}
+			if !reflect.DeepEqual(withdrawals, block.Withdrawals()) {
+				t.Fatalf("block %d: withdrawals mismatch: have %v, want %v", block.NumberU64(), withdrawals, block.Withdrawals())
+			}
+		}
+	}
+	if _, err := chain.GetWithdrawals(common.Hash{0x1}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestGetWithdrawalsByNumber(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestMergedReaderGenesis(), 4, addTestWithdrawals)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		withdrawals, err := chain.GetWithdrawalsByNumber(block.NumberU64())
+		if err != nil {
+			t.Fatalf("block %d: unexpected error: %v", block.NumberU64(), err)
+		}
+		if !reflect.DeepEqual(withdrawals, block.Withdrawals()) {
+			t.Fatalf("block %d: withdrawals mismatch: have %v, want %v", block.NumberU64(), withdrawals, block.Withdrawals())
+		}
+	}
+	if _, err := chain.GetWithdrawalsByNumber(uint64(len(blocks) + 1)); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+	// Blocks predating Shanghai have no withdrawals
+	legacy, legacyBlocks := newTestReaderChain(t, newTestReaderGenesis(), 1, nil)
+	defer legacy.Stop()
+
+	if withdrawals, err := legacy.GetWithdrawalsByNumber(legacyBlocks[0].NumberU64()); err != nil || len(withdrawals) != 0 {
+		t.Fatalf("legacy block: have %v, %v, want no withdrawals", withdrawals, err)
+	}
+}
+
+func TestGetSidecarByTxHash(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestMergedReaderGenesis(), 4, addTestBlobTransfers)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		for i, tx := range block.Transactions() {
+			sidecar, hash, err := chain.GetSidecarByTxHash(tx.Hash())
+			if hash != block.Hash() {
+				t.Fatalf("block %d tx %d: block hash mismatch: have %x, want %x", block.NumberU64(), i, hash, block.Hash())
+			}
+			if tx.Type() != types.BlobTxType {
+				if !errors.Is(err, errNotBlobTx) {
+					t.Fatalf("block %d tx %d: error mismatch: have %v, want %v", block.NumberU64(), i, err, errNotBlobTx)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("block %d tx %d: unexpected error: %v", block.NumberU64(), i, err)
+			}
+			if sidecar.TxHash != tx.Hash() || sidecar.TxIndex != uint64(i) || sidecar.BlockHash != block.Hash() {
+				t.Fatalf("block %d tx %d: sidecar mismatch: have %x #%d in %x", block.NumberU64(), i, sidecar.TxHash, sidecar.TxIndex, sidecar.BlockHash)
+			}
+		}
+	}
+	if sidecar, hash, err := chain.GetSidecarByTxHash(common.Hash{0x1}); sidecar != nil || hash != (common.Hash{}) || err != nil {
+		t.Fatalf("unknown transaction: have %v, %x, %v, want nothing", sidecar, hash, err)
+	}
+}
+
+func TestGetBlockWithSidecars(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestMergedReaderGenesis(), 4, addTestBlobTransfers)
+	defer chain.Stop()
+
+	for _, want := range blocks {
+		block, sidecars, err := chain.GetBlockWithSidecars(want.Hash())
+		if err != nil {
+			t.Fatalf("block %d: unexpected error: %v", want.NumberU64(), err)
+		}
+		if block.Hash() != want.Hash() {
+			t.Fatalf("block %d: hash mismatch: have %x, want %x", want.NumberU64(), block.Hash(), want.Hash())
+		}
+		if len(sidecars) != len(want.Sidecars()) {
+			t.Fatalf("block %d: sidecar count mismatch: have %d, want %d", want.NumberU64(), len(sidecars), len(want.Sidecars()))
+		}
+		for i, sidecar := range sidecars {
+			if sidecar.TxHash != want.Sidecars()[i].TxHash {
+				t.Fatalf("block %d sidecar %d: transaction mismatch: have %x, want %x", want.NumberU64(), i, sidecar.TxHash, want.Sidecars()[i].TxHash)
+			}
+		}
+	}
+	if _, _, err := chain.GetBlockWithSidecars(common.Hash{0x1}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+	// Side chain blocks are rejected, pre-Cancun blocks come without sidecars
+	legacy, forks := newTestForkChain(t)
+	defer legacy.Stop()
+
+	if _, err := legacy.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	if _, _, err := legacy.GetBlockWithSidecars(forks[0].Hash()); err == nil {
+		t.Fatal("expected error for side chain block")
+	}
+	head := legacy.CurrentBlock()
+	if block, sidecars, err := legacy.GetBlockWithSidecars(head.Hash()); err != nil || block == nil || sidecars != nil {
+		t.Fatalf("pre-Cancun block: have %v, %v, %v, want block without sidecars", block, sidecars, err)
+	}
+}
+
+func TestMissingSidecars(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestMergedReaderGenesis(), 4, addTestBlobTransfers)
+	defer chain.Stop()
+
+	head := uint64(len(blocks))
+	if missing, err := chain.MissingSidecars(0, head); err != nil || len(missing) != 0 {
+		t.Fatalf("complete chain: have %v, %v, want no missing sidecars", missing, err)
+	}
+	// Drop the sidecars of a blob-carrying block and ensure it's reported
+	block := blocks[2]
+	if len(block.Sidecars()) == 0 {
+		t.Fatalf("block %d: no sidecars generated", block.NumberU64())
+	}
+	rawdb.DeleteBlobSidecars(chain.db, block.Hash(), block.NumberU64())
+
+	if missing, err := chain.MissingSidecars(0, head); err != nil || !slices.Equal(missing, []uint64{block.NumberU64()}) {
+		t.Fatalf("pruned chain: have %v, %v, want [%d]", missing, err, block.NumberU64())
+	}
+	if _, err := chain.MissingSidecars(head, head+1); err == nil {
+		t.Fatal("expected error for range beyond the head")
+	}
+}
+
+func TestGetBlocksByRange(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 8, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Ranges overshooting the head are truncated at the head
+	tests := []struct {
+		from, to uint64
+		want     []uint64
+	}{
+		{0, 2, []uint64{0, 1, 2}},
+		{3, 20, []uint64{3, 4, 5, 6, 7, 8}},
+		{8, 8, []uint64{8}},
+		{9, 20, nil},
+	}
+	for i, tt := range tests {
+		blocks, err := chain.GetBlocksByRange(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve block range: %v", i, err)
+		}
+		blobs, err := chain.GetBlockRangeRLP(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve block range rlp: %v", i, err)
+		}
+		if len(blocks) != len(tt.want) || len(blobs) != len(tt.want) {
+			t.Fatalf("test %d: block count mismatch: have %d/%d, want %d", i, len(blocks), len(blobs), len(tt.want))
+		}
+		for j, number := range tt.want {
+			if hash := chain.GetCanonicalHash(number); blocks[j].Hash() != hash {
+				t.Fatalf("test %d: block #%d hash mismatch: have %x, want %x", i, number, blocks[j].Hash(), hash)
+			}
+			if !chain.blockCache.Contains(blocks[j].Hash()) {
+				t.Fatalf("test %d: block #%d not cached", i, number)
+			}
+			if want, _ := rlp.EncodeToBytes(blocks[j]); !bytes.Equal(blobs[j], want) {
+				t.Fatalf("test %d: block #%d rlp mismatch: have %x, want %x", i, number, blobs[j], want)
+			}
+		}
+	}
+}
+
+// Tests that the range based accessors reject inverted ranges and ranges
+// exceeding maxBlockRangeQuery blocks.
+func TestBlockRangeQueries(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 4, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Some accessors truncate the range at the head, fake a long enough chain
+	var (
+		header = chain.CurrentHeader()
+		block  = chain.CurrentBlock()
+		fake   = &types.Header{Number: big.NewInt(maxBlockRangeQuery)}
+	)
+	chain.hc.currentHeader.Store(fake)
+	chain.currentBlock.Store(fake)
+	defer func() {
+		chain.hc.currentHeader.Store(header)
+		chain.currentBlock.Store(block)
+	}()
+
+	tests := []struct {
+		name  string
+		query func(from, to uint64) error
+	}{
+		{"GetHeaderRange", func(from, to uint64) error { _, err := chain.GetHeaderRange(from, to); return err }},
+		{"GetBlocksByRange", func(from, to uint64) error { _, err := chain.GetBlocksByRange(from, to); return err }},
+		{"GetBlockRangeRLP", func(from, to uint64) error { _, err := chain.GetBlockRangeRLP(from, to); return err }},
+		{"MissingSidecars", func(from, to uint64) error { _, err := chain.MissingSidecars(from, to); return err }},
+		{"BlobStatsInRange", func(from, to uint64) error { _, _, err := chain.BlobStatsInRange(from, to); return err }},
+		{"FilterLogsInRange", func(from, to uint64) error { _, err := chain.FilterLogsInRange(from, to, nil, nil); return err }},
+		{"GetReceiptsInRange", func(from, to uint64) error { _, err := chain.GetReceiptsInRange(from, to); return err }},
+		{"ReceiptStatusHistogram", func(from, to uint64) error { _, _, err := chain.ReceiptStatusHistogram(from, to); return err }},
+		{"CanonicalHashDigest", func(from, to uint64) error { _, err := chain.CanonicalHashDigest(from, to); return err }},
+		{"VerifyCanonicalChain", chain.VerifyCanonicalChain},
+		{"ValidatorRewardSeries", func(from, to uint64) error { _, err := chain.ValidatorRewardSeries(from, to); return err }},
+	}
+	for _, tt := range tests {
+		if err := tt.query(5, 4); err == nil || !strings.Contains(err.Error(), "invalid") {
+			t.Errorf("%s: expected error for inverted range, have %v", tt.name, err)
+		}
+		if err := tt.query(0, maxBlockRangeQuery); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("%s: expected error for oversized range, have %v", tt.name, err)
+		}
+	}
+	// Canonical hashes are retrieved without an error
+	if hashes := chain.GetCanonicalHashes(5, 4); hashes != nil {
+		t.Error("GetCanonicalHashes: expected nil for inverted range")
+	}
+	if hashes := chain.GetCanonicalHashes(0, maxBlockRangeQuery); hashes != nil {
+		t.Error("GetCanonicalHashes: expected nil for oversized range")
+	}
+}
+
+func TestIterateHeaders(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 8, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Iterate until the end of the chain
+	var numbers []uint64
+	err = chain.IterateHeaders(2, func(header *types.Header) bool {
+		numbers = append(numbers, header.Number.Uint64())
+		return true
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate headers: %v", err)
+	}
+	if len(numbers) != 7 {
+		t.Fatalf("header count mismatch: have %d, want %d", len(numbers), 7)
+	}
+	for i, number := range numbers {
+		if number != uint64(i+2) {
+			t.Fatalf("header %d: number mismatch: have %d, want %d", i, number, i+2)
+		}
+	}
+	// Abort the iteration early
+	numbers = numbers[:0]
+	chain.IterateHeaders(0, func(header *types.Header) bool {
+		numbers = append(numbers, header.Number.Uint64())
+		return len(numbers) < 3
+	})
+	if len(numbers) != 3 {
+		t.Fatalf("header count mismatch: have %d, want %d", len(numbers), 3)
+	}
+}
+
+func TestGetTransactionReceipt(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 6, addTestTransfers)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		for i, tx := range block.Transactions() {
+			receipt, lookup, err := chain.GetTransactionReceipt(tx.Hash())
+			if err != nil {
+				t.Fatalf("tx %x: unexpected error: %v", tx.Hash(), err)
+			}
+			if receipt == nil || lookup == nil {
+				t.Fatalf("tx %x: receipt not found", tx.Hash())
+			}
+			if receipt.TxHash != tx.Hash() {
+				t.Fatalf("tx %x: receipt mismatch: have %x", tx.Hash(), receipt.TxHash)
+			}
+			if lookup.BlockHash != block.Hash() || lookup.Index != uint64(i) {
+				t.Fatalf("tx %x: lookup mismatch: have %x/%d, want %x/%d", tx.Hash(), lookup.BlockHash, lookup.Index, block.Hash(), i)
+			}
+		}
+	}
+	receipt, lookup, err := chain.GetTransactionReceipt(common.Hash{0x01})
+	if receipt != nil || lookup != nil || err != nil {
+		t.Fatalf("unknown transaction: have %v/%v/%v, want nil", receipt, lookup, err)
+	}
+}
+
+func TestGetReceiptsInRange(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 6, addTestTransfers)
+	defer chain.Stop()
+
+	receipts, err := chain.GetReceiptsInRange(1, 6)
+	if err != nil {
+		t.Fatalf("failed to get receipts: %v", err)
+	}
+	if len(receipts) != len(blocks) {
+		t.Fatalf("receipt set count mismatch: have %d, want %d", len(receipts), len(blocks))
+	}
+	for i, block := range blocks {
+		if len(receipts[i]) != len(block.Transactions()) {
+			t.Fatalf("block #%d: receipt count mismatch: have %d, want %d", block.NumberU64(), len(receipts[i]), len(block.Transactions()))
+		}
+		for j, tx := range block.Transactions() {
+			if receipts[i][j].TxHash != tx.Hash() {
+				t.Fatalf("block #%d: receipt %d mismatch: have %x, want %x", block.NumberU64(), j, receipts[i][j].TxHash, tx.Hash())
+			}
+		}
+	}
+	if _, err := chain.GetReceiptsInRange(5, 7); err == nil {
+		t.Fatal("expected error for range beyond the head")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := chain.GetReceiptsInRangeContext(ctx, 1, 6); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled scan: have %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCanonicalHashDigest(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 8, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	var blob []byte
+	for number := uint64(3); number <= 6; number++ {
+		blob = append(blob, chain.GetCanonicalHash(number).Bytes()...)
+	}
+	digest, err := chain.CanonicalHashDigest(3, 6)
+	if err != nil {
+		t.Fatalf("failed to compute digest: %v", err)
+	}
+	if want := crypto.Keccak256Hash(blob); digest != want {
+		t.Fatalf("digest mismatch: have %x, want %x", digest, want)
+	}
+	if _, err := chain.CanonicalHashDigest(3, 9); err == nil {
+		t.Fatal("expected error for range beyond the head")
+	}
+}
+
+func TestGetCanonicalHashes(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 8, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	hashes := chain.GetCanonicalHashes(6, 10)
+	if len(hashes) != 5 {
+		t.Fatalf("hash count mismatch: have %d, want 5", len(hashes))
+	}
+	for i, hash := range hashes {
+		want := common.Hash{}
+		if block := chain.GetBlockByNumber(uint64(6 + i)); block != nil {
+			want = block.Hash()
+		}
+		if hash != want {
+			t.Fatalf("hash #%d mismatch: have %x, want %x", 6+i, hash, want)
+		}
+	}
+}
+
+func TestGetHeadersWithSkip(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 16, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	tests := []struct {
+		number, count, skip uint64
+		reverse             bool
+		want                []uint64
+	}{
+		{2, 4, 2, false, []uint64{2, 5, 8, 11}},
+		{2, 10, 4, false, []uint64{2, 7, 12}},
+		{14, 4, 3, true, []uint64{14, 10, 6, 2}},
+		{10, 4, 0, true, []uint64{10, 9, 8, 7}},
+		{10, 4, 0, false, []uint64{10, 11, 12, 13}},
+		{3, 5, 1, true, []uint64{3, 1}},
+		{20, 3, 0, false, nil},
+		{0, 3, gomath.MaxUint64, false, nil},
+	}
+	for i, tt := range tests {
+		headers := chain.GetHeadersWithSkip(tt.number, tt.count, tt.skip, tt.reverse)
+		if len(headers) != len(tt.want) {
+			t.Fatalf("test %d: header count mismatch: have %d, want %d", i, len(headers), len(tt.want))
+		}
+		for j, data := range headers {
+			var header types.Header
+			if err := rlp.DecodeBytes(data, &header); err != nil {
+				t.Fatalf("test %d: failed to decode header %d: %v", i, j, err)
+			}
+			if header.Number.Uint64() != tt.want[j] {
+				t.Fatalf("test %d: header %d number mismatch: have %d, want %d", i, j, header.Number, tt.want[j])
+			}
+		}
+	}
+}
+
+func TestGetBodyFromBlockCache(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 4, addTestTransfers)
+	defer chain.Stop()
+
+	// Warm up the block cache and drop the body from disk, ensuring the body
+	// can only be served from the cached block.
+	block := blocks[1]
+	chain.bodyCache.Purge()
+	if chain.GetBlock(block.Hash(), block.NumberU64()) == nil {
+		t.Fatal("failed to retrieve block")
+	}
+	rawdb.DeleteBody(chain.db, block.Hash(), block.NumberU64())
+
+	body := chain.GetBody(block.Hash())
+	if body == nil {
+		t.Fatal("body not reconstructed from block cache")
+	}
+	if len(body.Transactions) != len(block.Transactions()) {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(body.Transactions), len(block.Transactions()))
+	}
+	if !chain.bodyCache.Contains(block.Hash()) {
+		t.Fatal("reconstructed body not cached")
+	}
+	// Mutating the returned body must not leak into the cached block
+	body.Transactions[0] = nil
+	if cached, _ := chain.blockCache.Get(block.Hash()); cached.Transactions()[0] == nil {
+		t.Fatal("body mutation leaked into the cached block")
+	}
+}
+
+func TestGetTransactionLookups(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 6, addTestTransfers)
+	defer chain.Stop()
+
+	// Mix known transactions with unknown ones, serving one of them from cache
+	var hashes []common.Hash
+	for _, block := range blocks {
+		for _, tx := range block.Transactions() {
+			hashes = append(hashes, tx.Hash(), common.Hash{0x01})
+		}
+	}
+	chain.GetTransactionLookup(hashes[0])
+
+	lookups, txs, errs := chain.GetTransactionLookups(hashes)
+	if len(lookups) != len(hashes) || len(txs) != len(hashes) || len(errs) != len(hashes) {
+		t.Fatalf("result length mismatch: have %d/%d/%d, want %d", len(lookups), len(txs), len(errs), len(hashes))
+	}
+	for i, hash := range hashes {
+		wantLookup, wantTx, wantErr := chain.GetTransactionLookup(hash)
+		if (errs[i] == nil) != (wantErr == nil) {
+			t.Fatalf("hash %x: error mismatch: have %v, want %v", hash, errs[i], wantErr)
+		}
+		if wantTx == nil {
+			if txs[i] != nil || lookups[i] != nil {
+				t.Fatalf("hash %x: unexpected lookup result", hash)
+			}
+			continue
+		}
+		if txs[i] == nil || txs[i].Hash() != hash {
+			t.Fatalf("hash %x: transaction mismatch", hash)
+		}
+		if *lookups[i] != *wantLookup {
+			t.Fatalf("hash %x: lookup mismatch: have %+v, want %+v", hash, lookups[i], wantLookup)
+		}
+	}
+}
+
+func TestCanonicalHashCacheReorg(t *testing.T) {
+	var (
+		gspec  = &Genesis{Config: params.TestChainConfig}
+		engine = ethash.NewFaker()
+	)
+	_, blocks, _ := GenerateChainWithGenesis(gspec, engine, 12, nil)
+	_, forks, _ := GenerateChainWithGenesis(gspec, engine, 11, func(i int, gen *BlockGen) {
+		if i >= 3 {
+			gen.SetCoinbase(common.Address{0x01})
+		}
+	})
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Hammer the number based accessors while the chain reorgs back and forth
+	var (
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for n := uint64(1); n <= 12; n++ {
+					chain.GetBlockByNumber(n)
+				}
+			}
+		}()
+	}
+	for _, segment := range [][]*types.Block{blocks[:10], forks, blocks[10:]} {
+		if _, err := chain.InsertChain(segment); err != nil {
+			t.Fatalf("failed to insert chain segment: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// All accessors must agree with the database after the reorgs
+	for n := uint64(1); n <= 12; n++ {
+		want := rawdb.ReadCanonicalHash(chain.db, n)
+		if want != blocks[n-1].Hash() {
+			t.Fatalf("block #%d: unexpected canonical hash %x, want %x", n, want, blocks[n-1].Hash())
+		}
+		if block := chain.GetBlockByNumber(n); block == nil || block.Hash() != want {
+			t.Fatalf("block #%d: stale block served: have %v, want %x", n, block, want)
+		}
+		if header := chain.GetHeaderByNumber(n); header == nil || header.Hash() != want {
+			t.Fatalf("block #%d: stale header served: have %v, want %x", n, header, want)
+		}
+		if hash := chain.GetCanonicalHash(n); hash != want {
+			t.Fatalf("block #%d: stale canonical hash: have %x, want %x", n, hash, want)
+		}
+	}
+}
+
+func TestStateAtContext(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 2, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	root := chain.CurrentBlock().Root
+	if _, err := chain.StateAtContext(context.Background(), root); err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	if _, err := chain.StateAtContext(context.Background(), common.Hash{0x01}); err == nil {
+		t.Fatal("expected error for unknown state")
+	}
+	// Cancelled contexts are rejected synchronously
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := chain.StateAtContext(ctx, root); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if _, err := chain.StateAtContext(ctx, root); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStateAtHeader(t *testing.T) {
+	var (
+		gspec  = &Genesis{Config: params.TestChainConfig}
+		engine = ethash.NewFaker()
+	)
+	_, blocks, _ := GenerateChainWithGenesis(gspec, engine, 140, nil)
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), "", "", false, false, false, false, false)
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	defer db.Close()
+
+	chain, err := NewBlockChain(db, DefaultCacheConfigWithScheme(rawdb.PathScheme), gspec, nil, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	head := blocks[len(blocks)-1]
+	if _, err := chain.StateAtBlock(head); err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	if _, err := chain.StateAtBlock(nil); err == nil {
+		t.Fatal("expected error for nil block")
+	}
+	if _, err := chain.StateAtHeader(nil); err == nil {
+		t.Fatal("expected error for nil header")
+	}
+	// The state of an early block is flushed out of the diff layers, it must not
+	// be recovered by the state accessors
+	target := blocks[4].Header()
+	if chain.HasState(target.Root) || !chain.StateRecoverable(target.Root) {
+		t.Fatalf("unexpected state availability of block #%d", target.Number)
+	}
+	if _, err := chain.StateAtHeader(target); err == nil {
+		t.Fatal("expected error for missing state")
+	}
+	if current := chain.CurrentBlock(); current.Hash() != head.Hash() {
+		t.Fatalf("head moved by state accessor: have #%d, want #%d", current.Number, head.Number())
+	}
+}
+
+func TestGetBlockByTimestamp(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 10, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	timeOf := func(number uint64) uint64 { return chain.GetHeaderByNumber(number).Time }
+
+	tests := []struct {
+		ts   uint64
+		want uint64
+	}{
+		{0, 0},
+		{timeOf(0), 0},
+		{timeOf(1) - 1, 0},
+		{timeOf(4), 4},
+		{timeOf(4) + 1, 4},
+		{timeOf(10), 10},
+		{timeOf(10) + 1000, 10},
+	}
+	for i, tt := range tests {
+		header, err := chain.GetBlockByTimestamp(tt.ts)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if header.Number.Uint64() != tt.want {
+			t.Fatalf("test %d: number mismatch: have %d, want %d", i, header.Number, tt.want)
+		}
+	}
+}
+
+// newTestForkChain creates a blockchain with 10 canonical blocks, along with a
+// side chain of 3 blocks forking off after block #4, which is not inserted yet.
+func newTestForkChain(t *testing.T) (*BlockChain, []*types.Block) {
+	genDb, _, chain, err := newCanonical(ethash.NewFaker(), 10, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	return chain, makeBlockChain(chain.chainConfig, chain.GetBlockByNumber(4), 3, ethash.NewFaker(), genDb, forkSeed)
+}
+
+func TestFindCommonAncestor(t *testing.T) {
+	chain, forks := newTestForkChain(t)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	var (
+		head = chain.CurrentBlock()
+		want = chain.GetHeaderByNumber(4)
+	)
+	ancestor, err := chain.FindCommonAncestor(head, forks[2].Header())
+	if err != nil {
+		t.Fatalf("failed to find common ancestor: %v", err)
+	}
+	if ancestor.Hash() != want.Hash() {
+		t.Fatalf("ancestor mismatch: have #%d [%x], want #%d [%x]", ancestor.Number, ancestor.Hash(), want.Number, want.Hash())
+	}
+	// Headers on the same chain resolve to the lower one
+	if ancestor, err = chain.FindCommonAncestor(chain.GetHeaderByNumber(3), chain.GetHeaderByNumber(9)); err != nil || ancestor.Hash() != chain.GetCanonicalHash(3) {
+		t.Fatalf("ancestor mismatch on the same chain: have %v, err %v", ancestor, err)
+	}
+	// The side chain forked off after block #4, the head is at #10
+	if depth, err := chain.ReorgDepth(forks[2].Header()); err != nil || depth != 6 {
+		t.Fatalf("reorg depth mismatch: have %d, err %v, want 6", depth, err)
+	}
+	if depth, err := chain.ReorgDepth(head); err != nil || depth != 0 {
+		t.Fatalf("reorg depth of the head mismatch: have %d, err %v, want 0", depth, err)
+	}
+	// Restrict the depth below the distance to the ancestor
+	chain.SetMaxAncestorDepth(5)
+	if _, err := chain.FindCommonAncestor(head, forks[2].Header()); err == nil {
+		t.Fatal("expected error when the ancestor is beyond the maximum depth")
+	}
+}
+
+func TestForkHeads(t *testing.T) {
+	chain, forks := newTestForkChain(t)
+	defer chain.Stop()
+
+	if heads := chain.ForkHeads(); len(heads) != 0 {
+		t.Fatalf("unexpected fork heads without side chain: %d", len(heads))
+	}
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	heads := chain.ForkHeads()
+	if len(heads) != 1 {
+		t.Fatalf("fork head count mismatch: have %d, want 1", len(heads))
+	}
+	if heads[0].Hash() != forks[2].Hash() {
+		t.Fatalf("fork head mismatch: have #%d [%x], want #%d [%x]", heads[0].Number, heads[0].Hash(), forks[2].Number(), forks[2].Hash())
+	}
+}
+
+func TestGetBlockNumber(t *testing.T) {
+	chain, forks := newTestForkChain(t)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	// Both canonical and side chain blocks are resolved
+	blocks := append(chain.GetBlocksFromHash(chain.CurrentBlock().Hash(), 11), forks...)
+	for _, block := range blocks {
+		if number := chain.GetBlockNumber(block.Hash()); number == nil || *number != block.NumberU64() {
+			t.Fatalf("block %x: number mismatch: have %v, want %d", block.Hash(), number, block.NumberU64())
+		}
+	}
+	if number := chain.GetBlockNumber(common.Hash{0x1}); number != nil {
+		t.Fatalf("unexpected number for unknown block: %d", *number)
+	}
+}
+
+func TestGetHeaderByHashOrNumber(t *testing.T) {
+	chain, forks := newTestForkChain(t)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	var (
+		head = chain.CurrentBlock()
+		side = forks[len(forks)-1]
+	)
+	tests := []struct {
+		hash    common.Hash
+		number  uint64
+		useHash bool
+		want    common.Hash // zero if no header is expected
+	}{
+		{common.Hash{}, 3, false, chain.GetCanonicalHash(3)},
+		{side.Hash(), head.Number.Uint64(), false, head.Hash()}, // hash ignored
+		{side.Hash(), 0, true, side.Hash()},
+		{common.Hash{}, head.Number.Uint64() + 1, false, common.Hash{}},
+		{common.Hash{0x1}, 1, true, common.Hash{}},
+	}
+	for i, tt := range tests {
+		var have common.Hash
+		if header := chain.GetHeaderByHashOrNumber(tt.hash, tt.number, tt.useHash); header != nil {
+			have = header.Hash()
+		}
+		if have != tt.want {
+			t.Errorf("test %d: header mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
+func TestGetBlockByNumberOrHash(t *testing.T) {
+	chain, forks := newTestForkChain(t)
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	var (
+		head = chain.CurrentBlock()
+		side = forks[len(forks)-1]
+	)
+	tests := []struct {
+		bnh  rpc.BlockNumberOrHash
+		want common.Hash // zero if no block is expected
+		fail bool
+	}{
+		{rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), head.Hash(), false},
+		{rpc.BlockNumberOrHashWithNumber(3), chain.GetCanonicalHash(3), false},
+		{rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(head.Number.Int64() + 1)), common.Hash{}, false},
+		{rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber), common.Hash{}, true},
+		{rpc.BlockNumberOrHashWithNumber(rpc.FinalizedBlockNumber), common.Hash{}, true},
+		{rpc.BlockNumberOrHashWithNumber(rpc.SafeBlockNumber), common.Hash{}, true},
+		{rpc.BlockNumberOrHashWithHash(head.Hash(), true), head.Hash(), false},
+		{rpc.BlockNumberOrHashWithHash(side.Hash(), false), side.Hash(), false},
+		{rpc.BlockNumberOrHashWithHash(side.Hash(), true), common.Hash{}, true},
+		{rpc.BlockNumberOrHashWithHash(common.Hash{0x1}, false), common.Hash{}, true},
+		{rpc.BlockNumberOrHash{}, common.Hash{}, true},
+	}
+	for i, tt := range tests {
+		block, err := chain.GetBlockByNumberOrHash(tt.bnh)
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d (%v): error mismatch: have %v, want failure %v", i, tt.bnh, err, tt.fail)
+			continue
+		}
+		var have common.Hash
+		if block != nil {
+			have = block.Hash()
+		}
+		if have != tt.want {
+			t.Errorf("test %d (%v): block mismatch: have %x, want %x", i, tt.bnh, have, tt.want)
+		}
+	}
+}
+
+func TestWaitForBlock(t *testing.T) {
+	_, genesis, chain, err := newCanonical(ethash.NewFaker(), 0, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	_, blocks := makeBlockChainWithGenesis(genesis, 6, ethash.NewFaker(), canonicalSeed)
+	if _, err := chain.InsertChain(blocks[:3]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Already canonical blocks are returned immediately
+	block, err := chain.WaitForBlock(context.Background(), 2)
+	if err != nil || block.Hash() != blocks[1].Hash() {
+		t.Fatalf("canonical block mismatch: have %v, err %v", block, err)
+	}
+	// Future blocks are returned once imported
+	result := make(chan *types.Block, 1)
+	go func() {
+		block, _ := chain.WaitForBlock(context.Background(), 5)
+		result <- block
+	}()
+	if _, err := chain.InsertChain(blocks[3:]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	select {
+	case block := <-result:
+		if block == nil || block.Hash() != blocks[4].Hash() {
+			t.Fatalf("awaited block mismatch: have %v, want %x", block, blocks[4].Hash())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for block")
+	}
+	// Unreachable blocks are aborted by the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := chain.WaitForBlock(ctx, 100); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStreamChainHeadsFrom(t *testing.T) {
+	_, genesis, chain, err := newCanonical(ethash.NewFaker(), 0, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	_, blocks := makeBlockChainWithGenesis(genesis, 8, ethash.NewFaker(), canonicalSeed)
+	if _, err := chain.InsertChain(blocks[:5]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		heads       = make(chan ChainHeadEvent)
+		result      = make(chan error, 1)
+	)
+	defer cancel()
+	go func() {
+		result <- chain.StreamChainHeadsFrom(ctx, 2, heads)
+	}()
+	expect := func(blocks []*types.Block) {
+		for _, block := range blocks {
+			select {
+			case ev := <-heads:
+				if ev.Header.Hash() != block.Hash() {
+					t.Fatalf("head mismatch: have #%d [%x], want #%d [%x]", ev.Header.Number, ev.Header.Hash(), block.Number(), block.Hash())
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for head #%d", block.Number())
+			}
+		}
+	}
+	// Historical heads are replayed first, then the live ones follow
+	expect(blocks[1:5])
+	if _, err := chain.InsertChain(blocks[5:]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	expect(blocks[5:])
+
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestTxIndexedEvent(t *testing.T) {
+	var (
+		gspec  = newTestReaderGenesis()
+		engine = ethash.NewFaker()
+		limit  = uint64(0)
+	)
+	generate := func(n int, coinbase common.Address) []*types.Block {
+		_, blocks, _ := GenerateChainWithGenesis(gspec, engine, n, func(i int, gen *BlockGen) {
+			gen.SetCoinbase(coinbase)
+			for j := 0; j < i%3; j++ {
+				addTestTransfer(gen, testAddr, common.Big0)
+			}
+		})
+		return blocks
+	}
+	blocks, forks := generate(6, common.Address{}), generate(8, common.Address{0x01})
+
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, engine, vm.Config{}, nil, &limit)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	events := make(chan TxIndexedEvent, 16)
+	sub := chain.SubscribeTxIndexedEvent(events)
+	defer sub.Unsubscribe()
+
+	// expect waits for the announcement of the given blocks in any order, empty
+	// blocks must not be announced.
+	expect := func(blocks []*types.Block) {
+		want := make(map[uint64]*types.Block)
+		for _, block := range blocks {
+			if len(block.Transactions()) > 0 {
+				want[block.NumberU64()] = block
+			}
+		}
+		for len(want) > 0 {
+			select {
+			case ev := <-events:
+				block := want[ev.Number]
+				if block == nil {
+					t.Fatalf("unexpected event for block #%d", ev.Number)
+				}
+				delete(want, ev.Number)
+				if len(ev.Hashes) != len(block.Transactions()) {
+					t.Fatalf("block #%d: announced tx count mismatch: have %d, want %d", ev.Number, len(ev.Hashes), len(block.Transactions()))
+				}
+				for i, hash := range ev.Hashes {
+					if hash != block.Transactions()[i].Hash() {
+						t.Fatalf("block #%d: announced tx %d mismatch: have %x, want %x", ev.Number, i, hash, block.Transactions()[i].Hash())
+					}
+					if lookup, _, _ := chain.GetTransactionLookup(hash); lookup == nil || lookup.BlockHash != block.Hash() {
+						t.Fatalf("block #%d: announced transaction %x not retrievable", ev.Number, hash)
+					}
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("missing events for %d blocks", len(want))
+			}
+		}
+		select {
+		case ev := <-events:
+			t.Fatalf("unexpected event for block #%d", ev.Number)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	// The first blocks are announced by the initial indexing, the rest on import
+	if _, err := chain.InsertChain(blocks[:3]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	expect(blocks[:3])
+	if _, err := chain.InsertChain(blocks[3:]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	expect(blocks[3:])
+
+	// Blocks reorged in are announced as well
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert side chain: %v", err)
+	}
+	expect(forks)
+}
+
+func TestTxIndexProgressEvent(t *testing.T) {
+	var (
+		gspec  = &Genesis{Config: params.TestChainConfig}
+		engine = ethash.NewFaker()
+		limit  = uint64(4)
+	)
+	_, blocks, _ := GenerateChainWithGenesis(gspec, engine, 8, nil)
+
+	// Subscriptions must fail if the indexer is disabled
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	sub := chain.SubscribeTxIndexProgressEvent(make(chan TxIndexProgress))
+	if err := <-sub.Err(); !errors.Is(err, errTxIndexerDisabled) {
+		t.Fatalf("subscription error mismatch: have %v, want %v", err, errTxIndexerDisabled)
+	}
+	chain.Stop()
+
+	chain, err = NewBlockChain(rawdb.NewMemoryDatabase(), nil, gspec, nil, engine, vm.Config{}, nil, &limit)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	events := make(chan TxIndexProgress, 16)
+	sub = chain.SubscribeTxIndexProgressEvent(events)
+	defer sub.Unsubscribe()
+
+	if _, err := chain.InsertChain(blocks[:6]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Wait for the indexing to be reported as finished
+	for done := false; !done; {
+		select {
+		case progress := <-events:
+			if done = progress.Done(); done && progress.Indexed != limit {
+				t.Fatalf("indexed block count mismatch: have %d, want %d", progress.Indexed, limit)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing indexing completion event")
+		}
+	}
+	// Advancing by fewer blocks than the reporting interval is not announced
+	if _, err := chain.InsertChain(blocks[6:]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	select {
+	case progress := <-events:
+		t.Fatalf("unexpected progress event: %+v", progress)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestIterateAncestors(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 6, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// A full walk ends after the genesis header
+	var hashes []common.Hash
+	chain.IterateAncestors(chain.GetCanonicalHash(5), 5, func(header *types.Header) bool {
+		hashes = append(hashes, header.Hash())
+		return true
+	})
+	if len(hashes) != 6 {
+		t.Fatalf("ancestor count mismatch: have %d, want 6", len(hashes))
+	}
+	for i, hash := range hashes[:5] {
+		if want := chain.GetCanonicalHash(uint64(5 - i)); hash != want {
+			t.Fatalf("ancestor %d mismatch: have %x, want %x", i, hash, want)
+		}
+	}
+	if hashes[5] != chain.Genesis().Hash() {
+		t.Fatalf("last ancestor mismatch: have %x, want genesis %x", hashes[5], chain.Genesis().Hash())
+	}
+	// The walk is aborted once the callback returns false
+	var numbers []uint64
+	chain.IterateAncestors(chain.GetCanonicalHash(5), 5, func(header *types.Header) bool {
+		numbers = append(numbers, header.Number.Uint64())
+		return header.Number.Uint64() > 3
+	})
+	if len(numbers) != 3 || numbers[2] != 3 {
+		t.Fatalf("aborted walk mismatch: have %v, want [5 4 3]", numbers)
+	}
+	// Unknown blocks yield nothing
+	chain.IterateAncestors(common.Hash{0xff}, 5, func(*types.Header) bool {
+		t.Fatal("unexpected callback for unknown block")
+		return false
+	})
+}
+
+func TestVerifyCanonicalChain(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 8, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if err := chain.VerifyCanonicalChain(0, 8); err != nil {
+		t.Fatalf("intact chain reported inconsistent: %v", err)
+	}
+	if err := chain.VerifyCanonicalChain(0, 9); err == nil {
+		t.Fatal("expected error for range beyond the head")
+	}
+	// Point a canonical number to a block at a different height
+	rawdb.WriteCanonicalHash(chain.db, chain.GetCanonicalHash(3), 5)
+	if err := chain.VerifyCanonicalChain(0, 8); err == nil {
+		t.Fatal("expected error for corrupted canonical chain")
+	}
+	if err := chain.VerifyCanonicalChain(0, 4); err != nil {
+		t.Fatalf("intact segment reported inconsistent: %v", err)
+	}
+}
+
+func TestWasInTurn(t *testing.T) {
+	_, genesis, chain, err := newCanonical(ethash.NewFullFaker(), 0, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Alternate between in-turn and out-of-turn difficulties
+	_, blocks, _ := GenerateChainWithGenesis(genesis, ethash.NewFullFaker(), 4, func(i int, gen *BlockGen) {
+		gen.SetDifficulty(big.NewInt(int64(2 - i%2)))
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for i, block := range blocks {
+		difficulty, err := chain.GetDifficulty(block.Hash())
+		if err != nil {
+			t.Fatalf("block #%d: failed to get difficulty: %v", block.NumberU64(), err)
+		}
+		if difficulty.Cmp(block.Difficulty()) != 0 {
+			t.Fatalf("block #%d: difficulty mismatch: have %v, want %v", block.NumberU64(), difficulty, block.Difficulty())
+		}
+		inturn, err := chain.WasInTurn(block.Hash())
+		if err != nil {
+			t.Fatalf("block #%d: failed to check turn: %v", block.NumberU64(), err)
+		}
+		if want := i%2 == 0; inturn != want {
+			t.Fatalf("block #%d: in-turn mismatch: have %v, want %v", block.NumberU64(), inturn, want)
+		}
+	}
+	if _, err := chain.WasInTurn(common.Hash{0x01}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestCurrentTd(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 4, nil)
+	defer chain.Stop()
+
+	want := new(big.Int).Set(chain.Genesis().Difficulty())
+	for _, block := range blocks {
+		want.Add(want, block.Difficulty())
+	}
+	if td := chain.CurrentTd(); td == nil || td.Cmp(want) != 0 {
+		t.Fatalf("total difficulty mismatch: have %v, want %v", td, want)
+	}
+	// Drop the head total difficulty and ensure its absence is reported
+	head := chain.CurrentBlock()
+	rawdb.DeleteTd(chain.db, head.Hash(), head.Number.Uint64())
+	chain.hc.tdCache.Purge()
+
+	if td := chain.CurrentTd(); td != nil {
+		t.Fatalf("unexpected total difficulty for missing entry: %v", td)
+	}
+}
+
+func TestGetHeaderAndTd(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 4, nil)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		header, td := chain.GetHeaderAndTd(block.Hash(), block.NumberU64())
+		if header == nil || header.Hash() != block.Hash() {
+			t.Fatalf("block %d: header mismatch: have %v, want %x", block.NumberU64(), header, block.Hash())
+		}
+		if want := chain.GetTd(block.Hash(), block.NumberU64()); td == nil || td.Cmp(want) != 0 {
+			t.Fatalf("block %d: total difficulty mismatch: have %v, want %v", block.NumberU64(), td, want)
+		}
+	}
+	if header, td := chain.GetHeaderAndTd(common.Hash{0x1}, 1); header != nil || td != nil {
+		t.Fatalf("unexpected result for unknown block: %v, %v", header, td)
+	}
+}
+
+func TestBlockTxCount(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 6, addTestTransfers)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		// Count from the raw body first, then from the warm caches
+		chain.bodyCache.Purge()
+		chain.blockCache.Purge()
+		for i := 0; i < 2; i++ {
+			count, err := chain.BlockTxCount(block.Hash())
+			if err != nil {
+				t.Fatalf("block %d: unexpected error: %v", block.NumberU64(), err)
+			}
+			if count != len(block.Transactions()) {
+				t.Fatalf("block %d: count mismatch: have %d, want %d", block.NumberU64(), count, len(block.Transactions()))
+			}
+			chain.GetBody(block.Hash())
+		}
+	}
+	if _, err := chain.BlockTxCount(common.Hash{0x01}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestGetTransactions(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 6, addTestTransfers)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		// Evict the caches to exercise the partial body decoding
+		chain.bodyCache.Purge()
+		chain.blockCache.Purge()
+
+		txs, err := chain.GetTransactions(block.Hash())
+		if err != nil {
+			t.Fatalf("block #%d: failed to get transactions: %v", block.NumberU64(), err)
+		}
+		if len(txs) != len(block.Transactions()) {
+			t.Fatalf("block #%d: transaction count mismatch: have %d, want %d", block.NumberU64(), len(txs), len(block.Transactions()))
+		}
+		for i, tx := range txs {
+			if tx.Hash() != block.Transactions()[i].Hash() {
+				t.Fatalf("block #%d: transaction %d mismatch: have %x, want %x", block.NumberU64(), i, tx.Hash(), block.Transactions()[i].Hash())
+			}
+		}
+	}
+	if _, err := chain.GetTransactions(common.Hash{0xff}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestPinBlock(t *testing.T) {
+	_, _, chain, err := newCanonical(ethash.NewFaker(), 4, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+	chain.SetMaxPinnedBlocks(2)
+
+	var blocks []*types.Block
+	for number := uint64(1); number <= 4; number++ {
+		blocks = append(blocks, chain.GetBlockByNumber(number))
+	}
+
+	for _, block := range blocks[:2] {
+		if err := chain.PinBlock(block.Hash()); err != nil {
+			t.Fatalf("block %d: failed to pin: %v", block.NumberU64(), err)
+		}
+	}
+	if err := chain.PinBlock(blocks[2].Hash()); err == nil {
+		t.Fatal("expected error when exceeding the pin limit")
+	}
+	if err := chain.PinBlock(common.Hash{0x01}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+	// Evict the pinned block from both the cache and the disk
+	block := blocks[0]
+	chain.blockCache.Purge()
+	rawdb.DeleteBody(chain.db, block.Hash(), block.NumberU64())
+	if have := chain.GetBlock(block.Hash(), block.NumberU64()); have == nil || have.Hash() != block.Hash() {
+		t.Fatal("pinned block not served after eviction")
+	}
+	// Unpinned blocks go through the regular path
+	chain.UnpinBlock(block.Hash())
+	chain.blockCache.Purge()
+	if chain.GetBlock(block.Hash(), block.NumberU64()) != nil {
+		t.Fatal("unpinned block served after eviction")
+	}
+	if err := chain.PinBlock(blocks[2].Hash()); err != nil {
+		t.Fatalf("failed to pin after unpinning: %v", err)
+	}
+}
+
+func TestGetDerivedReceipts(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 6, addTestTransfers)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		receipts, err := chain.GetDerivedReceipts(block.Hash())
+		if err != nil {
+			t.Fatalf("block %d: unexpected error: %v", block.NumberU64(), err)
+		}
+		if len(receipts) != len(block.Transactions()) {
+			t.Fatalf("block %d: receipt count mismatch: have %d, want %d", block.NumberU64(), len(receipts), len(block.Transactions()))
+		}
+		for i, receipt := range receipts {
+			tx := block.Transactions()[i]
+			if receipt.TxHash != tx.Hash() || receipt.BlockHash != block.Hash() || receipt.TransactionIndex != uint(i) {
+				t.Fatalf("block %d receipt %d: context mismatch", block.NumberU64(), i)
+			}
+			if receipt.GasUsed != params.TxGas || receipt.EffectiveGasPrice == nil {
+				t.Fatalf("block %d receipt %d: gas fields not derived", block.NumberU64(), i)
+			}
+		}
+		if !chain.receiptsCache.Contains(block.Hash()) {
+			t.Fatalf("block %d: derived receipts not cached", block.NumberU64())
+		}
+	}
+	if _, err := chain.GetDerivedReceipts(common.Hash{0x01}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestGetReceiptsRLP(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 6, addTestTransfers)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		blob := chain.GetReceiptsRLP(block.Hash())
+		if !bytes.Equal(blob, rawdb.ReadReceiptsRLP(chain.db, block.Hash(), block.NumberU64())) {
+			t.Fatalf("block %d: receipts RLP mismatch", block.NumberU64())
+		}
+		var receipts []*types.ReceiptForStorage
+		if err := rlp.DecodeBytes(blob, &receipts); err != nil {
+			t.Fatalf("block %d: failed to decode receipts: %v", block.NumberU64(), err)
+		}
+		if len(receipts) != len(block.Transactions()) {
+			t.Fatalf("block %d: receipt count mismatch: have %d, want %d", block.NumberU64(), len(receipts), len(block.Transactions()))
+		}
+		if !chain.receiptsRLPCache.Contains(block.Hash()) {
+			t.Fatalf("block %d: receipts RLP not cached", block.NumberU64())
+		}
+	}
+	if blob := chain.GetReceiptsRLP(common.Hash{0x1}); blob != nil {
+		t.Fatalf("unexpected receipts for unknown block: %x", blob)
+	}
+}
+
+func TestPrunedBlockEvent(t *testing.T) {
+	var (
+		gspec  = &Genesis{Config: params.TestChainConfig}
+		engine = ethash.NewFaker()
+	)
+	_, blocks, _ := GenerateChainWithGenesis(gspec, engine, 10, nil)
+
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), "", "", false, false, false, false, false)
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	defer db.Close()
+	if err := db.SetupFreezerEnv(&ethdb.FreezerEnv{ChainCfg: gspec.Config}); err != nil {
+		t.Fatalf("failed to setup freezer env: %v", err)
+	}
+	chain, err := NewBlockChain(db, nil, gspec, nil, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	events := make(chan PrunedEvent, 1)
+	sub := chain.SubscribePrunedBlockEvent(events)
+	defer sub.Unsubscribe()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	expect := func(from, to uint64) {
+		select {
+		case ev := <-events:
+			if ev.From != from || ev.To != to {
+				t.Fatalf("pruned range mismatch: have [%d, %d], want [%d, %d]", ev.From, ev.To, from, to)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing event for pruned range [%d, %d]", from, to)
+		}
+	}
+	// Freeze all but the last 3 blocks
+	db.(interface{ Freeze(threshold uint64) error }).Freeze(3)
+	expect(0, 7)
+	if frozen, _ := db.Ancients(); frozen != 8 {
+		t.Fatalf("frozen block count mismatch: have %d, want 8", frozen)
+	}
+	// Only the newly frozen blocks are announced on the next cycle
+	db.(interface{ Freeze(threshold uint64) error }).Freeze(1)
+	expect(8, 9)
+}
+
+func TestRegenerateState(t *testing.T) {
+	var (
+		gspec  = newTestReaderGenesis()
+		engine = ethash.NewFaker()
+		db     = rawdb.NewMemoryDatabase()
+		config = DefaultCacheConfigWithScheme(rawdb.HashScheme)
+	)
+	_, blocks, _ := GenerateChainWithGenesis(gspec, engine, 8, func(i int, gen *BlockGen) {
+		addTestTransfer(gen, common.Address{byte(i)}, common.Big0)
+	})
+	// Write all states to disk, then prune a few of them by dropping their roots
+	config.TrieDirtyDisabled = true
+	config.SnapshotLimit = 0
+
+	chain, err := NewBlockChain(db, config, gspec, nil, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	chain.Stop()
+	for _, block := range blocks[2:6] {
+		rawdb.DeleteLegacyTrieNode(db, block.Root())
+	}
+	chain, err = NewBlockChain(db, config, gspec, nil, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	target := blocks[5]
+	if _, err := chain.StateAt(target.Root()); err == nil {
+		t.Fatal("pruned state still available")
+	}
+	tests := []struct {
+		root      common.Hash
+		maxReplay uint64
+		nonce     uint64 // Nonce of the tester account, 0 if an error is expected
+	}{
+		{target.Root(), 4, 6},     // closest state at #2
+		{target.Root(), 3, 0},     // gap exceeds the replay limit
+		{common.Hash{0x01}, 4, 0}, // unknown root
+		{blocks[7].Root(), 0, 8},  // state available without replay
+		{blocks[2].Root(), 1, 3},  // parent state available
+		{blocks[3].Root(), 1, 0},  // parent state pruned as well
+	}
+	for i, tt := range tests {
+		statedb, err := chain.RegenerateState(tt.root, tt.maxReplay)
+		if tt.nonce == 0 {
+			if err == nil {
+				t.Fatalf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to regenerate state: %v", i, err)
+		}
+		if root := statedb.IntermediateRoot(true); root != tt.root {
+			t.Fatalf("test %d: state root mismatch: have %x, want %x", i, root, tt.root)
+		}
+		if nonce := statedb.GetNonce(testAddr); nonce != tt.nonce {
+			t.Fatalf("test %d: nonce mismatch: have %d, want %d", i, nonce, tt.nonce)
+		}
+	}
+	// Regeneration must not leak into the live database
+	if _, err := chain.StateAt(target.Root()); err == nil {
+		t.Fatal("regenerated state leaked into the live database")
+	}
+}
+
+// newStateDiffTester creates a chain and commits a state on top of its genesis,
+// which creates, updates and deletes accounts and storage slots. The snapshots
+// are disabled unless requested.
+func newStateDiffTester(t *testing.T, snapshots bool) (chain *BlockChain, oldRoot, newRoot common.Hash) {
+	var (
+		gspec = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: types.GenesisAlloc{
+				common.Address{0xa}: {Balance: big.NewInt(1), Storage: map[common.Hash]common.Hash{{0x1}: {0x1}, {0x2}: {0x2}}},
+				common.Address{0xb}: {Balance: big.NewInt(1)},
+				common.Address{0xc}: {Balance: big.NewInt(1)},
+			},
+		}
+		config = DefaultCacheConfigWithScheme(rawdb.HashScheme)
+	)
+	if !snapshots {
+		config.SnapshotLimit = 0
+	}
+	chain, err := NewBlockChain(rawdb.NewMemoryDatabase(), config, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	oldRoot = chain.Genesis().Root()
+	statedb, err := state.New(oldRoot, chain.statedb)
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	statedb.SetState(common.Address{0xa}, common.Hash{0x1}, common.Hash{0x10})
+	statedb.SetState(common.Address{0xa}, common.Hash{0x2}, common.Hash{})
+	statedb.SetState(common.Address{0xa}, common.Hash{0x3}, common.Hash{0x3})
+	statedb.SelfDestruct(common.Address{0xb})
+	statedb.SetNonce(common.Address{0xd}, 1, tracing.NonceChangeUnspecified)
+	statedb.SetState(common.Address{0xd}, common.Hash{0x5}, common.Hash{0x5})
+	statedb.SetNonce(common.Address{0xe}, 1, tracing.NonceChangeUnspecified)
+
+	if newRoot, _, err = statedb.Commit(1, true, false); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	return chain, oldRoot, newRoot
+}
+
+func TestStateDiff(t *testing.T) {
+	chain, oldRoot, newRoot := newStateDiffTester(t, true)
+	defer chain.Stop()
+
+	account := func(addr common.Address) common.Hash { return crypto.Keccak256Hash(addr.Bytes()) }
+	slot := func(value common.Hash) []byte {
+		blob, _ := rlp.EncodeToBytes(common.TrimLeftZeroes(value[:]))
+		return blob
+	}
+	// hashes maps the changed accounts to their number of changed slots
+	hashes := func(diffs []AccountDiff) map[common.Hash]int {
+		res := make(map[common.Hash]int)
+		for _, diff := range diffs {
+			res[diff.Hash] = len(diff.Storage)
+		}
+		return res
+	}
+	// reverse turns a diff of the new state against the old one around
+	reverse := func(diffs []AccountDiff) []AccountDiff {
+		for i := range diffs {
+			diffs[i].Before, diffs[i].After = diffs[i].After, diffs[i].Before
+			for j := range diffs[i].Storage {
+				diffs[i].Storage[j].Before, diffs[i].Storage[j].After = diffs[i].Storage[j].After, diffs[i].Storage[j].Before
+			}
+		}
+		return diffs
+	}
+	// The snapshot of the new state is a diff layer on top of the old one, which
+	// is diffed directly. The other way around, both snapshots are walked in full.
+	snap := chain.snaps.Snapshot(newRoot)
+	if _, ok := snap.(snapshotLayer); !ok || snap.Parent() == nil || snap.Parent().Root() != oldRoot {
+		t.Fatal("new snapshot not layered on top of the old one")
+	}
+	for _, reversed := range []bool{false, true} {
+		from, to := oldRoot, newRoot
+		if reversed {
+			from, to = newRoot, oldRoot
+		}
+		diff, err := chain.StateDiff(from, to)
+		if err != nil {
+			t.Fatalf("reversed %v: failed to diff states: %v", reversed, err)
+		}
+		if reversed {
+			diff = &StateDiffResult{Created: reverse(diff.Deleted), Updated: reverse(diff.Updated), Deleted: reverse(diff.Created)}
+		}
+		tests := []struct {
+			name  string
+			have  []AccountDiff
+			want  map[common.Hash]int
+			check func(AccountDiff) bool
+		}{
+			{"created", diff.Created, map[common.Hash]int{account(common.Address{0xd}): 1, account(common.Address{0xe}): 0}, func(d AccountDiff) bool {
+				return d.Before == nil && d.After != nil && d.After.Nonce == 1
+			}},
+			{"updated", diff.Updated, map[common.Hash]int{account(common.Address{0xa}): 3}, func(d AccountDiff) bool {
+				return d.Before != nil && d.After != nil && d.Before.Root != d.After.Root
+			}},
+			{"deleted", diff.Deleted, map[common.Hash]int{account(common.Address{0xb}): 0}, func(d AccountDiff) bool {
+				return d.Before != nil && d.After == nil
+			}},
+		}
+		for _, tt := range tests {
+			if have := hashes(tt.have); !maps.Equal(have, tt.want) {
+				t.Fatalf("reversed %v: %s accounts mismatch: have %v, want %v", reversed, tt.name, have, tt.want)
+			}
+			for i, d := range tt.have {
+				if !tt.check(d) {
+					t.Fatalf("reversed %v: %s account %d: invalid diff: %+v", reversed, tt.name, i, d)
+				}
+				if i > 0 && tt.have[i-1].Hash.Cmp(d.Hash) >= 0 {
+					t.Fatalf("reversed %v: %s accounts not in hash order", reversed, tt.name)
+				}
+			}
+		}
+		// Check the storage changes of the updated account
+		storage := make(map[common.Hash][2][]byte)
+		for _, d := range diff.Updated[0].Storage {
+			storage[d.Hash] = [2][]byte{d.Before, d.After}
+		}
+		for key, want := range map[common.Hash][2][]byte{
+			crypto.Keccak256Hash(common.Hash{0x1}.Bytes()): {slot(common.Hash{0x1}), slot(common.Hash{0x10})},
+			crypto.Keccak256Hash(common.Hash{0x2}.Bytes()): {slot(common.Hash{0x2}), nil},
+			crypto.Keccak256Hash(common.Hash{0x3}.Bytes()): {nil, slot(common.Hash{0x3})},
+		} {
+			if have := storage[key]; !bytes.Equal(have[0], want[0]) || !bytes.Equal(have[1], want[1]) {
+				t.Fatalf("reversed %v: slot %x mismatch: have %x, want %x", reversed, key, have, want)
+			}
+		}
+	}
+	// Unknown states must be rejected
+	if _, err := chain.StateDiff(oldRoot, common.Hash{0x1}); err == nil {
+		t.Fatal("expected error for unknown state")
+	}
+}
+
+func TestStateSizeDelta(t *testing.T) {
+	chain, oldRoot, newRoot := newStateDiffTester(t, true)
+	defer chain.Stop()
+
+	tests := []struct {
+		parent, child common.Hash
+		accounts      int64
+		slots         int64
+	}{
+		{oldRoot, newRoot, 1, 1},   // 2 accounts and 2 slots added, 1 account and 1 slot deleted
+		{newRoot, oldRoot, -1, -1}, // reverse direction, walking the snapshots in full
+		{oldRoot, oldRoot, 0, 0},   // no changes
+	}
+	for i, tt := range tests {
+		accounts, slots, err := chain.StateSizeDelta(tt.parent, tt.child)
+		if err != nil {
+			t.Fatalf("test %d: failed to compute delta: %v", i, err)
+		}
+		if accounts != tt.accounts || slots != tt.slots {
+			t.Fatalf("test %d: delta mismatch: have %d/%d, want %d/%d", i, accounts, slots, tt.accounts, tt.slots)
+		}
+	}
+	if _, _, err := chain.StateSizeDelta(oldRoot, common.Hash{0x1}); err == nil {
+		t.Fatal("expected error for unknown state")
+	}
+}
+
+// Tests that the state diffs require the snapshots, even if the state tries are
+// available.
+func TestStateDiffWithoutSnapshots(t *testing.T) {
+	chain, oldRoot, newRoot := newStateDiffTester(t, false)
+	defer chain.Stop()
+
+	if !chain.HasState(oldRoot) || !chain.HasState(newRoot) {
+		t.Fatal("state tries not available")
+	}
+	if _, err := chain.StateDiff(oldRoot, newRoot); err == nil {
+		t.Fatal("expected error for missing snapshots")
+	}
+	if _, _, err := chain.StateSizeDelta(oldRoot, newRoot); err == nil {
+		t.Fatal("expected error for missing snapshots")
+	}
+}
+
+func TestSnapshotAccounts(t *testing.T) {
+	chain, _, root := newStateDiffTester(t, true)
+	defer chain.Stop()
+
+	// Page through the accounts and ensure every live one is returned once
+	var (
+		have  []common.Hash
+		start common.Hash
+	)
+	for {
+		accounts, next, err := chain.SnapshotAccounts(root, start, 3)
+		if err != nil {
+			t.Fatalf("failed to retrieve accounts from %x: %v", start, err)
+		}
+		if len(accounts) > 3 {
+			t.Fatalf("page too large: have %d, want at most 3", len(accounts))
+		}
+		for _, account := range accounts {
+			have = append(have, account.Hash)
+		}
+		if next == (common.Hash{}) {
+			break
+		}
+		start = next
+	}
+	var want []common.Hash
+	for _, addr := range []common.Address{{0xa}, {0xc}, {0xd}, {0xe}} {
+		want = append(want, crypto.Keccak256Hash(addr.Bytes()))
+	}
+	slices.SortFunc(want, func(a, b common.Hash) int { return a.Cmp(b) })
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("account mismatch: have %x, want %x", have, want)
+	}
+	// Invalid limits and unknown roots must be rejected
+	for _, tt := range []struct {
+		root common.Hash
+		max  int
+	}{
+		{root, 0},
+		{root, -1},
+		{root, maxSnapshotAccounts + 1},
+		{common.Hash{0x1}, 1},
+	} {
+		if _, _, err := chain.SnapshotAccounts(tt.root, common.Hash{}, tt.max); err == nil {
+			t.Errorf("root %x, max %d: expected error", tt.root, tt.max)
+		}
+	}
+}
+
+func TestGetProof(t *testing.T) {
+	chain, _, root := newStateDiffTester(t, false)
+	defer chain.Stop()
+
+	// verify checks a proof against the given root and returns the proven value
+	verify := func(root common.Hash, key []byte, proof [][]byte) ([]byte, error) {
+		db := memorydb.New()
+		for _, node := range proof {
+			db.Put(crypto.Keccak256(node), node)
+		}
+		return trie.VerifyProof(root, crypto.Keccak256(key), db)
+	}
+	tests := []struct {
+		addr   common.Address
+		keys   []common.Hash
+		exists bool
+		values []common.Hash
+	}{
+		{common.Address{0xa}, []common.Hash{{0x1}, {0x2}, {0x3}}, true, []common.Hash{{0x10}, {}, {0x3}}}, // slots present and deleted
+		{common.Address{0xb}, nil, false, nil},                               // deleted account
+		{common.Address{0xc}, []common.Hash{{0x1}}, true, []common.Hash{{}}}, // account without storage
+	}
+	for i, tt := range tests {
+		proof, err := chain.GetProof(tt.addr, tt.keys, root)
+		if err != nil {
+			t.Fatalf("test %d: failed to generate proof: %v", i, err)
+		}
+		blob, err := verify(root, tt.addr.Bytes(), proof.Proof)
+		if err != nil {
+			t.Fatalf("test %d: invalid account proof: %v", i, err)
+		}
+		if exists := blob != nil; exists != tt.exists {
+			t.Fatalf("test %d: account existence mismatch: have %v, want %v", i, exists, tt.exists)
+		}
+		if blob != nil {
+			var account types.StateAccount
+			if err := rlp.DecodeBytes(blob, &account); err != nil {
+				t.Fatalf("test %d: failed to decode account: %v", i, err)
+			}
+			if account.Root != proof.StorageRoot || account.Nonce != proof.Nonce || account.Balance.ToBig().Cmp(proof.Balance) != 0 {
+				t.Fatalf("test %d: proven account mismatch: have %+v, want %+v", i, account, proof)
+			}
+		}
+		for j, slot := range proof.Storage {
+			if slot.Value != tt.values[j] {
+				t.Fatalf("test %d slot %d: value mismatch: have %x, want %x", i, j, slot.Value, tt.values[j])
+			}
+			if proof.StorageRoot == types.EmptyRootHash {
+				if len(slot.Proof) != 0 {
+					t.Fatalf("test %d slot %d: unexpected proof of empty storage", i, j)
+				}
+				continue
+			}
+			blob, err := verify(proof.StorageRoot, slot.Key.Bytes(), slot.Proof)
+			if err != nil {
+				t.Fatalf("test %d slot %d: invalid storage proof: %v", i, j, err)
+			}
+			var want []byte
+			if slot.Value != (common.Hash{}) {
+				want, _ = rlp.EncodeToBytes(common.TrimLeftZeroes(slot.Value[:]))
+			}
+			if !bytes.Equal(blob, want) {
+				t.Fatalf("test %d slot %d: proven value mismatch: have %x, want %x", i, j, blob, want)
+			}
+		}
+	}
+}
+
+func TestAccountsExist(t *testing.T) {
+	var (
+		addrs = []common.Address{{0xa}, {0xb}, {0xc}}
+		gspec = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: types.GenesisAlloc{
+				addrs[0]: {Balance: big.NewInt(1)},
+				addrs[2]: {Balance: big.NewInt(1)},
+			},
+		}
+		want = []bool{true, false, true}
+	)
+	tests := []struct {
+		name      string
+		snapshots bool
+		partial   bool // Whether the snapshot is only partially generated
+	}{
+		{"snapshot", true, false},
+		{"generating snapshot", true, true},
+		{"trie", false, false},
+	}
+	for _, tt := range tests {
+		var (
+			db     = rawdb.NewMemoryDatabase()
+			config = DefaultCacheConfigWithScheme(rawdb.HashScheme)
+		)
+		if !tt.snapshots {
+			config.SnapshotLimit = 0
+		}
+		chain, err := NewBlockChain(db, config, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: failed to create tester chain: %v", tt.name, err)
+		}
+		if tt.partial {
+			// Reset the snapshot generation progress and reopen the chain without
+			// resuming it, leaving every account uncovered
+			chain.Stop()
+			generator, _ := rlp.EncodeToBytes(struct {
+				Wiping                   bool
+				Done                     bool
+				Marker                   []byte
+				Accounts, Slots, Storage uint64
+			}{Marker: []byte{}})
+			rawdb.WriteSnapshotGenerator(db, generator)
+
+			config.SnapshotNoBuild = true
+			if chain, err = NewBlockChain(db, config, gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil); err != nil {
+				t.Fatalf("%s: failed to reopen tester chain: %v", tt.name, err)
+			}
+			if _, err := chain.snaps.Snapshot(chain.Genesis().Root()).Account(crypto.Keccak256Hash(addrs[0].Bytes())); err == nil {
+				t.Fatalf("%s: snapshot not generating", tt.name)
+			}
+		}
+		have, err := chain.AccountsExist(chain.Genesis().Root(), addrs)
+		if err != nil {
+			t.Fatalf("%s: failed to check accounts: %v", tt.name, err)
+		}
+		if !slices.Equal(have, want) {
+			t.Fatalf("%s: existence mismatch: have %v, want %v", tt.name, have, want)
+		}
+		if _, err := chain.AccountsExist(common.Hash{0x1}, addrs); err == nil {
+			t.Fatalf("%s: expected error for unknown state", tt.name)
+		}
+		chain.Stop()
+	}
+}
+
+// newTestLogChain creates a blockchain with n blocks, each calling one of two
+// contracts emitting a single log with the topics 1,2 and 1,3 respectively. The
+// first contract is called in odd blocks, the second one in even blocks.
+func newTestLogChain(t *testing.T, n int) (chain *BlockChain, blocks []*types.Block, contract1, contract2 common.Address) {
+	contract1, contract2 = common.Address{0x10}, common.Address{0x20}
+
+	gspec := newTestReaderGenesis()
+	gspec.Alloc[contract1] = types.Account{Balance: common.Big0, Code: []byte{byte(vm.PUSH1), 0x2, byte(vm.PUSH1), 0x1, byte(vm.PUSH1), 0x0, byte(vm.PUSH1), 0x0, byte(vm.LOG2)}}
+	gspec.Alloc[contract2] = types.Account{Balance: common.Big0, Code: []byte{byte(vm.PUSH1), 0x3, byte(vm.PUSH1), 0x1, byte(vm.PUSH1), 0x0, byte(vm.PUSH1), 0x0, byte(vm.LOG2)}}
+
+	signer := types.LatestSigner(gspec.Config)
+	chain, blocks = newTestReaderChain(t, gspec, n, func(i int, gen *BlockGen) {
+		to := contract1
+		if i%2 == 1 {
+			to = contract2
+		}
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(testAddr), to, common.Big0, 100000, gen.header.BaseFee, nil), signer, testKey)
+		gen.AddTx(tx)
+	})
+	return chain, blocks, contract1, contract2
+}
+
+func TestFilterLogsInRange(t *testing.T) {
+	chain, _, contract1, contract2 := newTestLogChain(t, 6)
+	defer chain.Stop()
+
+	topic := func(n int64) common.Hash { return common.BigToHash(big.NewInt(n)) }
+
+	tests := []struct {
+		from, to  uint64
+		addresses []common.Address
+		topics    [][]common.Hash
+		want      []uint64 // Block numbers of the matching logs
+	}{
+		{1, 6, nil, nil, []uint64{1, 2, 3, 4, 5, 6}},
+		{2, 3, nil, nil, []uint64{2, 3}},
+		{1, 6, []common.Address{contract1}, nil, []uint64{1, 3, 5}},
+		{1, 6, []common.Address{contract1, contract2}, nil, []uint64{1, 2, 3, 4, 5, 6}},
+		{1, 6, []common.Address{{0x30}}, nil, nil},
+		{1, 6, nil, [][]common.Hash{{topic(1)}}, []uint64{1, 2, 3, 4, 5, 6}},
+		{1, 6, nil, [][]common.Hash{{}, {topic(3)}}, []uint64{2, 4, 6}},
+		{1, 6, nil, [][]common.Hash{{topic(1)}, {topic(2), topic(3)}}, []uint64{1, 2, 3, 4, 5, 6}},
+		{1, 6, []common.Address{contract1}, [][]common.Hash{{}, {topic(3)}}, nil},
+		{1, 6, nil, [][]common.Hash{{topic(2)}}, nil},
+		{1, 6, nil, [][]common.Hash{{topic(1)}, {topic(2)}, {}}, nil}, // more topics than logged
+	}
+	for i, tt := range tests {
+		logs, err := chain.FilterLogsInRange(tt.from, tt.to, tt.addresses, tt.topics)
+		if err != nil {
+			t.Fatalf("test %d: failed to filter logs: %v", i, err)
+		}
+		var have []uint64
+		for _, l := range logs {
+			have = append(have, l.BlockNumber)
+		}
+		if !slices.Equal(have, tt.want) {
+			t.Fatalf("test %d: log blocks mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+	// Cancelled filtering must be aborted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := chain.FilterLogsInRangeContext(ctx, 1, 6, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancellation error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestBlockRewards(t *testing.T) {
+	// Include transfers with descending tips in the first block, leave the second
+	// one empty
+	chain, _ := newTestReaderChain(t, newTestReaderGenesis(), 2, func(i int, gen *BlockGen) {
+		if i != 0 {
+			return
+		}
+		for tip := int64(4); tip > 0; tip-- {
+			addTestTransfer(gen, common.Address{0x1}, big.NewInt(tip*params.GWei))
+		}
+	})
+	defer chain.Stop()
+
+	tests := []struct {
+		number      uint64
+		percentiles []float64
+		want        []int64 // Tips in gwei, nil if an error is expected
+	}{
+		{1, []float64{0, 25, 50, 75, 100}, []int64{1, 1, 2, 3, 4}},
+		{1, []float64{10, 60}, []int64{1, 3}},
+		{1, nil, []int64{}},
+		{2, []float64{0, 50, 100}, []int64{0, 0, 0}}, // empty block
+		{3, []float64{50}, nil},                      // unknown block
+		{1, []float64{-1}, nil},
+		{1, []float64{101}, nil},
+		{1, []float64{50, 50}, nil},
+		{1, []float64{50, 25}, nil},
+	}
+	for i, tt := range tests {
+		rewards, err := chain.BlockRewards(tt.number, tt.percentiles)
+		if tt.want == nil {
+			if err == nil {
+				t.Fatalf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to compute rewards: %v", i, err)
+		}
+		have := make([]int64, len(rewards))
+		for j, reward := range rewards {
+			have[j] = new(big.Int).Div(reward, big.NewInt(params.GWei)).Int64()
+		}
+		if !slices.Equal(have, tt.want) {
+			t.Fatalf("test %d: rewards mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+func TestValidatorRewardSeries(t *testing.T) {
+	tips := [][]int64{{1, 2}, nil, {5}} // Tips in gwei of the transactions per block
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), len(tips), func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{byte(i + 1)})
+		for _, tip := range tips[i] {
+			addTestTransfer(gen, common.Address{0x1}, big.NewInt(tip*params.GWei))
+		}
+	})
+	defer chain.Stop()
+
+	rewards, err := chain.ValidatorRewardSeries(1, uint64(len(blocks)))
+	if err != nil {
+		t.Fatalf("failed to compute rewards: %v", err)
+	}
+	if len(rewards) != len(blocks) {
+		t.Fatalf("reward count mismatch: have %d, want %d", len(rewards), len(blocks))
+	}
+	for i, reward := range rewards {
+		var want int64
+		for _, tip := range tips[i] {
+			want += tip * params.GWei * int64(params.TxGas)
+		}
+		block := blocks[i]
+		if reward.Number != block.NumberU64() || reward.Hash != block.Hash() || reward.Validator != block.Coinbase() {
+			t.Fatalf("block %d: reward metadata mismatch: have %d/%x/%x", block.NumberU64(), reward.Number, reward.Hash, reward.Validator)
+		}
+		if reward.Reward.Cmp(big.NewInt(want)) != 0 {
+			t.Fatalf("block %d: reward mismatch: have %v, want %v", block.NumberU64(), reward.Reward, want)
+		}
+	}
+	if _, err := chain.ValidatorRewardSeries(1, uint64(len(blocks)+1)); err == nil {
+		t.Fatal("expected error for range beyond the head")
+	}
+}
+
+func TestGetSupplyDelta(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 4, addTestTransfers)
+	defer chain.Stop()
+
+	for _, block := range blocks {
+		delta, err := chain.GetSupplyDelta(block.NumberU64())
+		if err != nil {
+			t.Fatalf("block %d: failed to compute supply delta: %v", block.NumberU64(), err)
+		}
+		want := new(big.Int).Mul(block.BaseFee(), new(big.Int).SetUint64(block.GasUsed()))
+		if delta.Cmp(want) != 0 {
+			t.Fatalf("block %d: supply delta mismatch: have %v, want %v", block.NumberU64(), delta, want)
+		}
+		if (delta.Sign() == 0) != (len(block.Transactions()) == 0) {
+			t.Fatalf("block %d: burn mismatch with %d transactions: %v", block.NumberU64(), len(block.Transactions()), delta)
+		}
+	}
+	if _, err := chain.GetSupplyDelta(uint64(len(blocks) + 1)); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestGetLogsByHash(t *testing.T) {
+	chain, blocks, _, _ := newTestLogChain(t, 4)
+	defer chain.Stop()
+
+	for _, cached := range []bool{true, false} {
+		for _, block := range blocks {
+			// Serve the logs from the receipt cache or the database
+			chain.receiptsCache.Purge()
+			if cached {
+				chain.GetReceiptsByHash(block.Hash())
+			}
+			logs, err := chain.GetLogsByHash(block.Hash())
+			if err != nil {
+				t.Fatalf("block %d: failed to retrieve logs: %v", block.NumberU64(), err)
+			}
+			receipts := chain.GetReceiptsByHash(block.Hash())
+			if len(logs) != len(receipts) {
+				t.Fatalf("block %d: log group count mismatch: have %d, want %d", block.NumberU64(), len(logs), len(receipts))
+			}
+			for i, receipt := range receipts {
+				if len(logs[i]) != len(receipt.Logs) {
+					t.Fatalf("block %d tx %d: log count mismatch: have %d, want %d", block.NumberU64(), i, len(logs[i]), len(receipt.Logs))
+				}
+				for j, want := range receipt.Logs {
+					if have := logs[i][j]; !reflect.DeepEqual(have, want) {
+						t.Fatalf("block %d tx %d log %d: mismatch: have %+v, want %+v", block.NumberU64(), i, j, have, want)
+					}
+				}
+			}
+		}
+	}
+	if _, err := chain.GetLogsByHash(common.Hash{0x1}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestCodeHashesInBlock(t *testing.T) {
+	chain, blocks, contract1, contract2 := newTestLogChain(t, 4)
+	defer chain.Stop()
+
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	for i, block := range blocks {
+		want := statedb.GetCodeHash(contract1)
+		if i%2 == 1 {
+			want = statedb.GetCodeHash(contract2)
+		}
+		hashes, err := chain.CodeHashesInBlock(block.Hash())
+		if err != nil {
+			t.Fatalf("block %d: unexpected error: %v", block.NumberU64(), err)
+		}
+		if !slices.Equal(hashes, []common.Hash{want}) {
+			t.Fatalf("block %d: code hash mismatch: have %x, want [%x]", block.NumberU64(), hashes, want)
+		}
+	}
+	if hashes, err := chain.CodeHashesInBlock(chain.Genesis().Hash()); err != nil || len(hashes) != 0 {
+		t.Fatalf("genesis: have %x, %v, want no code hashes", hashes, err)
+	}
+	if _, err := chain.CodeHashesInBlock(common.Hash{0x1}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+}
+
+func TestContractCodeSize(t *testing.T) {
+	chain, _, contract, _ := newTestLogChain(t, 1)
+	defer chain.Stop()
+
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to open head state: %v", err)
+	}
+	code := statedb.GetCode(contract)
+
+	tests := []struct {
+		hash common.Hash
+		drop bool // Whether to delete the code from the database first
+		size int
+		ok   bool
+	}{
+		{crypto.Keccak256Hash(code), false, len(code), true},
+		{crypto.Keccak256Hash(code), true, len(code), true}, // served from the cache
+		{types.EmptyCodeHash, false, 0, true},
+		{common.Hash{0x1}, false, 0, false},
+	}
+	for i, tt := range tests {
+		if tt.drop {
+			rawdb.DeleteCode(chain.db, tt.hash)
+		}
+		size, err := chain.ContractCodeSize(tt.hash)
+		if (err == nil) != tt.ok {
+			t.Fatalf("test %d: error mismatch: have %v, want ok %v", i, err, tt.ok)
+		}
+		if size != tt.size {
+			t.Fatalf("test %d: size mismatch: have %d, want %d", i, size, tt.size)
+		}
+	}
+}
+
+func TestHasBlocks(t *testing.T) {
+	chain, blocks := newTestReaderChain(t, newTestReaderGenesis(), 4, addTestTransfers)
+	defer chain.Stop()
+
+	// Store a side header without a body, and make sure the blocks are not
+	// served from the cache
+	orphan := types.CopyHeader(blocks[2].Header())
+	orphan.Extra = []byte("orphan")
+	rawdb.WriteHeader(chain.db, orphan)
+	chain.blockCache.Purge()
+
+	pairs := []struct {
+		Hash   common.Hash
+		Number uint64
+	}{
+		{blocks[0].Hash(), blocks[0].NumberU64()},
+		{orphan.Hash(), orphan.Number.Uint64()}, // missing body
+		{blocks[3].Hash(), blocks[3].NumberU64()},
+		{blocks[3].Hash(), blocks[3].NumberU64() + 1}, // missing header
+	}
+	have := chain.HasBlocks(pairs)
+	if want := []bool{true, false, true, false}; !slices.Equal(have, want) {
+		t.Fatalf("block presence mismatch: have %v, want %v", have, want)
+	}
+	for i, pair := range pairs {
+		if single := chain.HasBlock(pair.Hash, pair.Number); single != have[i] {
+			t.Fatalf("entry %d: batched presence %v differs from HasBlock %v", i, have[i], single)
+		}
+	}
+}
+
+// testPoSA is an ethash faker posing as a PoSA engine, where the block two below
+// the given head is justified.
+type testPoSA struct {
+	consensus.Engine
+}
+
+func (e *testPoSA) IsSystemTransaction(tx *types.Transaction, header *types.Header) (bool, error) {
+	return false, nil
+}
+
+func (e *testPoSA) IsSystemContract(to *common.Address) bool { return false }
+
+func (e *testPoSA) EnoughDistance(chain consensus.ChainReader, header *types.Header) bool {
+	return true
+}
+
+func (e *testPoSA) IsLocalBlock(header *types.Header) bool { return false }
+
+func (e *testPoSA) GetFinalizedHeader(chain consensus.ChainHeaderReader, header *types.Header) *types.Header {
+	return nil
+}
+
+func (e *testPoSA) VerifyVote(chain consensus.ChainHeaderReader, vote *types.VoteEnvelope) error {
+	return nil
+}
+
+func (e *testPoSA) IsActiveValidatorAt(chain consensus.ChainHeaderReader, header *types.Header, checkVoteKeyFn func(bLSPublicKey *types.BLSPublicKey) bool) bool {
+	return false
+}
+
+func (e *testPoSA) BlockInterval() uint64 { return 3000 }
+
+func (e *testPoSA) NextProposalBlock(chain consensus.ChainHeaderReader, header *types.Header, proposer common.Address) (uint64, uint64, error) {
+	return 0, 0, nil
+}
+
+func (e *testPoSA) GetJustifiedNumberAndHash(chain consensus.ChainHeaderReader, headers []*types.Header) (uint64, common.Hash, error) {
+	header := headers[len(headers)-1]
+	for i := 0; i < 2 && header.Number.Sign() > 0; i++ {
+		if header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return 0, common.Hash{}, errors.New("unknown ancestor")
+		}
+	}
+	return header.Number.Uint64(), header.Hash(), nil
+}
+
+func TestSafeHeaderEvent(t *testing.T) {
+	_, genesis, chain, err := newCanonical(&testPoSA{ethash.NewFaker()}, 0, true, rawdb.HashScheme)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	_, blocks := makeBlockChainWithGenesis(genesis, 8, ethash.NewFaker(), canonicalSeed)
+
+	events := make(chan SafeHeaderEvent, 16)
+	sub := chain.SubscribeSafeHeaderEvent(events)
+	defer sub.Unsubscribe()
+
+	// expect checks that the given safe headers were announced in order
+	expect := func(numbers ...uint64) {
+		for _, number := range numbers {
+			select {
+			case ev := <-events:
+				if ev.Header.Number.Uint64() != number || ev.Header.Hash() != blocks[number-1].Hash() {
+					t.Fatalf("safe header mismatch: have #%d [%x], want #%d", ev.Header.Number, ev.Header.Hash(), number)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("missing safe header event #%d", number)
+			}
+		}
+		select {
+		case ev := <-events:
+			t.Fatalf("unexpected safe header event #%d", ev.Header.Number)
+		default:
+		}
+	}
+	tests := []struct {
+		setHead uint64 // Chain head to rewind to first, 0 to skip
+		insert  []*types.Block
+		want    []uint64
+	}{
+		{0, blocks[:6], []uint64{4}},
+		{0, blocks[6:7], []uint64{5}},
+		{0, blocks[7:8], []uint64{6}},
+		{3, blocks[3:4], []uint64{2}}, // announced again after a rewind
+		{0, blocks[4:6], []uint64{4}},
+	}
+	for i, tt := range tests {
+		if tt.setHead > 0 {
+			if err := chain.SetHead(tt.setHead); err != nil {
+				t.Fatalf("test %d: failed to rewind chain: %v", i, err)
+			}
+		}
+		if _, err := chain.InsertChain(tt.insert); err != nil {
+			t.Fatalf("test %d: failed to insert chain: %v", i, err)
+		}
+		expect(tt.want...)
+	}
+}
+
+func TestForEachStorage(t *testing.T) {
+	chain, _, root := newStateDiffTester(t, false)
+	defer chain.Stop()
+
+	// Slots are reported by their original keys only if the preimages are known
+	want := map[common.Hash]common.Hash{{0x1}: {0x10}, {0x3}: {0x3}}
+	hashed := make(map[common.Hash]common.Hash)
+	for key := range want {
+		hashed[crypto.Keccak256Hash(key.Bytes())] = key
+	}
+	tests := []struct {
+		addr  common.Address
+		limit int // Number of slots to accept before stopping the iteration
+		want  int
+	}{
+		{common.Address{0xa}, 10, 2},
+		{common.Address{0xa}, 1, 1},  // iteration stopped early
+		{common.Address{0xc}, 10, 0}, // account without storage
+		{common.Address{0xf}, 10, 0}, // non-existent account
+	}
+	for i, tt := range tests {
+		have := make(map[common.Hash]common.Hash)
+		err := chain.ForEachStorage(tt.addr, root, func(key, value common.Hash) bool {
+			if original, ok := hashed[key]; ok {
+				key = original
+			}
+			if want[key] != value {
+				t.Fatalf("test %d: slot %x value mismatch: have %x, want %x", i, key, value, want[key])
+			}
+			have[key] = value
+			return len(have) < tt.limit
+		})
+		if err != nil {
+			t.Fatalf("test %d: failed to iterate storage: %v", i, err)
+		}
+		if len(have) != tt.want {
+			t.Fatalf("test %d: slot count mismatch: have %d, want %d", i, len(have), tt.want)
+		}
+	}
+	if err := chain.ForEachStorage(common.Address{0xa}, common.Hash{0x1}, func(key, value common.Hash) bool { return true }); err == nil {
+		t.Fatal("expected error for unknown state")
+	}
+}
@@ -1162,6 +1162,61 @@ func testLogReorgs(t *testing.T, scheme string) {
 	}
 }
 
+func TestReorgEvent(t *testing.T) {
+	testReorgEvent(t, rawdb.HashScheme)
+	testReorgEvent(t, rawdb.PathScheme)
+}
+
+func testReorgEvent(t *testing.T, scheme string) {
+	var (
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: types.GenesisAlloc{addr1: {Balance: big.NewInt(10000000000000000)}}}
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	blockchain, _ := NewBlockChain(rawdb.NewMemoryDatabase(), DefaultCacheConfigWithScheme(scheme), gspec, nil, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer blockchain.Stop()
+
+	reorgCh := make(chan ReorgEvent, 1)
+	sub := blockchain.SubscribeReorgEvent(reorgCh)
+	defer sub.Unsubscribe()
+
+	// Import a chain whose second block differs from the fork below
+	_, chainA, _ := GenerateChainWithGenesis(gspec, ethash.NewFaker(), 2, func(i int, gen *BlockGen) {
+		if i == 1 {
+			tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr1), addr1, big.NewInt(1000), params.TxGas, gen.header.BaseFee, nil), signer, key1)
+			gen.AddTx(tx)
+		}
+	})
+	if _, err := blockchain.InsertChain(chainA); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	select {
+	case ev := <-reorgCh:
+		t.Fatalf("unexpected reorg event on chain extension: %v", ev)
+	default:
+	}
+	// Import a longer fork sharing the first block, triggering a reorg
+	_, chainB, _ := GenerateChainWithGenesis(gspec, ethash.NewFaker(), 3, func(i int, gen *BlockGen) {})
+	if _, err := blockchain.InsertChain(chainB); err != nil {
+		t.Fatalf("failed to insert forked chain: %v", err)
+	}
+	select {
+	case ev := <-reorgCh:
+		if ev.OldHead.Hash() != chainA[1].Hash() {
+			t.Errorf("old head mismatch: have %x, want %x", ev.OldHead.Hash(), chainA[1].Hash())
+		}
+		if ev.CommonAncestor.Hash() != chainB[0].Hash() {
+			t.Errorf("common ancestor mismatch: have %x, want %x", ev.CommonAncestor.Hash(), chainB[0].Hash())
+		}
+		if n := ev.NewHead.Number.Uint64(); n < 2 || ev.NewHead.Hash() != chainB[n-1].Hash() {
+			t.Errorf("new head #%d [%x] not part of the fork", n, ev.NewHead.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no reorg event received")
+	}
+}
+
 // This EVM code generates a log when the contract is created.
 var logCode = common.Hex2Bytes("60606040525b7f24ec1d3ff24c2f6ff210738839dbc339cd45a5294d85c79361016243157aae7b60405180905060405180910390a15b600a8060416000396000f360606040526008565b00")
 
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
@@ -32,12 +33,53 @@ type NewMinedBlockEvent struct{ Block *types.Block }
 // RemovedLogsEvent is posted when a reorg happens
 type RemovedLogsEvent struct{ Logs []*types.Log }
 
+// ReorgEvent is posted when a reorg happens, carrying the old and new heads of
+// the canonical chain along with their common ancestor.
+type ReorgEvent struct {
+	OldHead        *types.Header
+	NewHead        *types.Header
+	CommonAncestor *types.Header
+}
+
+// SidecarsEvent is posted when the blob sidecars of a canonical block have been
+// imported and persisted.
+type SidecarsEvent struct {
+	Hash     common.Hash
+	Number   uint64
+	Sidecars types.BlobSidecars
+}
+
+// TxIndexedEvent is posted when the lookup entries of the transactions in a
+// block have been written, i.e. the transactions became retrievable by hash.
+type TxIndexedEvent struct {
+	Number uint64
+	Hashes []common.Hash
+}
+
+// BlockProcessingError is posted when a block fails validation or processing
+// during import.
+type BlockProcessingError struct {
+	Hash   common.Hash
+	Number uint64
+	Err    error
+}
+
+// PrunedEvent is posted when the blocks in the range [From, To] have been moved
+// out of the key-value store, either into the ancient store or discarded.
+type PrunedEvent struct {
+	From uint64
+	To   uint64
+}
+
 // NewVoteEvent is posted when a batch of votes enters the vote pool.
 type NewVoteEvent struct{ Vote *types.VoteEnvelope }
 
 // FinalizedHeaderEvent is posted when a finalized header is reached.
 type FinalizedHeaderEvent struct{ Header *types.Header }
 
+// SafeHeaderEvent is posted when the safe (justified) header advances.
+type SafeHeaderEvent struct{ Header *types.Header }
+
 type ChainEvent struct {
 	Header *types.Header
 }
@@ -56,6 +56,25 @@ func ReadCanonicalHash(db ethdb.Reader, number uint64) common.Hash {
 	return common.BytesToHash(data)
 }
 
+// ReadCanonicalHashes is the batched version of ReadCanonicalHash, retrieving the
+// canonical hashes of the blocks in the range [from, to] within a single freezer
+// read operation. Missing numbers are filled with zero hashes.
+func ReadCanonicalHashes(db ethdb.Reader, from, to uint64) []common.Hash {
+	hashes := make([]common.Hash, to-from+1)
+	db.BlockStoreReader().ReadAncients(func(reader ethdb.AncientReaderOp) error {
+		for i := range hashes {
+			number := from + uint64(i)
+			data, _ := reader.Ancient(ChainFreezerHashTable, number)
+			if len(data) == 0 {
+				data, _ = db.BlockStoreReader().Get(headerHashKey(number))
+			}
+			hashes[i] = common.BytesToHash(data)
+		}
+		return nil
+	})
+	return hashes
+}
+
 // WriteCanonicalHash stores the hash assigned to a canonical block number.
 func WriteCanonicalHash(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	if err := db.Put(headerHashKey(number), hash.Bytes()); err != nil {
@@ -501,6 +520,25 @@ func HasBody(db ethdb.Reader, hash common.Hash, number uint64) bool {
 	return true
 }
 
+// HasBodies is the batched version of HasBody, resolving all ancient lookups
+// within a single freezer read operation. The hashes and numbers must be of the
+// same length, the result is index-aligned with them.
+func HasBodies(db ethdb.Reader, hashes []common.Hash, numbers []uint64) []bool {
+	has := make([]bool, len(hashes))
+	db.BlockStoreReader().ReadAncients(func(reader ethdb.AncientReaderOp) error {
+		for i, hash := range hashes {
+			if isCanon(reader, numbers[i], hash) {
+				has[i] = true
+				continue
+			}
+			ok, err := db.BlockStoreReader().Has(blockBodyKey(numbers[i], hash))
+			has[i] = ok && err == nil
+		}
+		return nil
+	})
+	return has
+}
+
 // ReadBody retrieves the block body corresponding to the hash.
 func ReadBody(db ethdb.Reader, hash common.Hash, number uint64) *types.Body {
 	data := ReadBodyRLP(db, hash, number)
@@ -898,6 +936,19 @@ func ReadBlobSidecars(db ethdb.Reader, hash common.Hash, number uint64) types.Bl
 	return ret
 }
 
+// HasBlobSidecars verifies the existence of all the transaction blobs belonging
+// to a block.
+func HasBlobSidecars(db ethdb.Reader, hash common.Hash, number uint64) bool {
+	if isCanon(db.BlockStoreReader(), number, hash) {
+		has, err := db.BlockStoreReader().HasAncient(ChainFreezerBlobSidecarTable, number)
+		return err == nil && has
+	}
+	if has, err := db.BlockStoreReader().Has(blockBlobSidecarsKey(number, hash)); !has || err != nil {
+		return false
+	}
+	return true
+}
+
 // WriteBlobSidecars stores all the transaction blobs belonging to a block.
 // It could input nil for empty blobs.
 func WriteBlobSidecars(db ethdb.KeyValueWriter, hash common.Hash, number uint64, blobs types.BlobSidecars) {
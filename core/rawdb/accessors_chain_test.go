@@ -112,6 +112,45 @@ func TestBodyStorage(t *testing.T) {
 	}
 }
 
+// Tests the batched body presence checks, both in the key-value store and in
+// the ancient store.
+func TestHasBodies(t *testing.T) {
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), t.TempDir(), "", false, false, false, false, false)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend")
+	}
+	defer db.Close()
+
+	// Freeze the genesis block and store a live body on top
+	ancient := types.NewBlockWithHeader(&types.Header{
+		Number:      big.NewInt(0),
+		Extra:       []byte("test block"),
+		UncleHash:   types.EmptyUncleHash,
+		TxHash:      types.EmptyTxsHash,
+		ReceiptHash: types.EmptyReceiptsHash,
+	})
+	if _, err := WriteAncientBlocks(db, []*types.Block{ancient}, []types.Receipts{nil}, big.NewInt(100)); err != nil {
+		t.Fatalf("failed to write ancient block: %v", err)
+	}
+	live := common.Hash{0x05}
+	WriteBody(db, live, 5, &types.Body{Uncles: []*types.Header{{Extra: []byte("test header")}}})
+
+	var (
+		hashes  = []common.Hash{ancient.Hash(), {0x01}, live, live, {0x06}}
+		numbers = []uint64{0, 0, 5, 6, 6}
+		want    = []bool{true, false, true, false, false}
+	)
+	have := HasBodies(db, hashes, numbers)
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("body presence mismatch: have %v, want %v", have, want)
+	}
+	for i := range hashes {
+		if single := HasBody(db, hashes[i], numbers[i]); single != have[i] {
+			t.Fatalf("entry %d: batched presence %v differs from HasBody %v", i, have[i], single)
+		}
+	}
+}
+
 // Tests block storage and retrieval operations.
 func TestBlockStorage(t *testing.T) {
 	db := NewMemoryDatabase()
@@ -458,9 +497,16 @@ func TestBlockBlobSidecarsStorage(t *testing.T) {
 	if bs := ReadBlobSidecars(db, blkHash, 0); len(bs) != 0 {
 		t.Fatalf("non existent sidecars returned: %v", bs)
 	}
+	if HasBlobSidecars(db, blkHash, 0) {
+		t.Fatalf("non existent sidecars reported as present")
+	}
 	WriteBody(db, blkHash, 0, body)
 	WriteBlobSidecars(db, blkHash, 0, sidecars)
 
+	if !HasBlobSidecars(db, blkHash, 0) {
+		t.Fatalf("stored sidecars reported as missing")
+	}
+
 	if bs := ReadBlobSidecars(db, blkHash, 0); len(bs) == 0 {
 		t.Fatalf("no sidecars returned")
 	} else {
@@ -473,6 +519,9 @@ func TestBlockBlobSidecarsStorage(t *testing.T) {
 	if bs := ReadBlobSidecars(db, blkHash, 0); len(bs) != 0 {
 		t.Fatalf("deleted sidecars returned: %v", bs)
 	}
+	if HasBlobSidecars(db, blkHash, 0) {
+		t.Fatalf("deleted sidecars reported as present")
+	}
 }
 
 func checkReceiptsRLP(have, want types.Receipts) error {
@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -47,6 +48,14 @@ var (
 	missFreezerEnvErr = errors.New("missing freezer env error")
 )
 
+// FrozenEvent is posted by the freezer when the blocks in the range [From, To]
+// have been moved out of the key-value store, either into the ancient store or
+// discarded altogether.
+type FrozenEvent struct {
+	From uint64
+	To   uint64
+}
+
 // chainFreezer is a wrapper of chain ancient store with additional chain freezing
 // feature. The background thread will keep moving ancient chain segments from
 // key-value database to flat files for saving space on live database.
@@ -63,6 +72,8 @@ type chainFreezer struct {
 	waitEnvTimes int
 
 	multiDatabase bool
+
+	frozenFeed event.Feed // Feed of block ranges moved out of the key-value store
 }
 
 // newChainFreezer initializes the freezer for ancient chain segment.
@@ -107,6 +118,25 @@ func (f *chainFreezer) Close() error {
 	return f.AncientStore.Close()
 }
 
+// SubscribeFrozenEvent registers a subscription of FrozenEvent, posted after
+// each freeze cycle and tail truncation.
+func (f *chainFreezer) SubscribeFrozenEvent(ch chan<- FrozenEvent) event.Subscription {
+	return f.frozenFeed.Subscribe(ch)
+}
+
+// TruncateTail discards all data below the provided threshold number, and
+// announces the discarded blocks.
+func (f *chainFreezer) TruncateTail(tail uint64) (uint64, error) {
+	old, err := f.AncientStore.TruncateTail(tail)
+	if err != nil {
+		return old, err
+	}
+	if tail > old {
+		f.frozenFeed.Send(FrozenEvent{From: old, To: tail - 1})
+	}
+	return old, nil
+}
+
 // readHeadNumber returns the number of chain head block. 0 is returned if the
 // block is unknown or not available yet.
 func (f *chainFreezer) readHeadNumber(db ethdb.Reader) uint64 {
@@ -390,6 +420,10 @@ func (f *chainFreezer) freeze(db ethdb.KeyValueStore) {
 		}
 		log.Debug("Deep froze chain segment", context...)
 
+		if frozen > first {
+			f.frozenFeed.Send(FrozenEvent{From: first, To: frozen - 1})
+		}
+
 		env, _ := f.freezeEnv.Load().(*ethdb.FreezerEnv)
 		// try prune blob data after cancun fork
 		if isCancun(env, head.Number, head.Time) {
@@ -0,0 +1,64 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+func TestChainFreezerTruncateTailEvent(t *testing.T) {
+	f := &chainFreezer{
+		AncientStore: NewMemoryFreezer(false, map[string]bool{ChainFreezerHashTable: true}),
+	}
+	_, err := f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := uint64(0); i < 10; i++ {
+			if err := op.AppendRaw(ChainFreezerHashTable, i, []byte{byte(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to append ancients: %v", err)
+	}
+	events := make(chan FrozenEvent, 1)
+	sub := f.SubscribeFrozenEvent(events)
+	defer sub.Unsubscribe()
+
+	if _, err := f.TruncateTail(4); err != nil {
+		t.Fatalf("failed to truncate tail: %v", err)
+	}
+	select {
+	case ev := <-events:
+		if ev.From != 0 || ev.To != 3 {
+			t.Fatalf("discarded range mismatch: have [%d, %d], want [0, 3]", ev.From, ev.To)
+		}
+	default:
+		t.Fatal("missing event for the discarded range")
+	}
+	// Truncating below the current tail discards nothing
+	if _, err := f.TruncateTail(2); err != nil {
+		t.Fatalf("failed to truncate tail: %v", err)
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event for range [%d, %d]", ev.From, ev.To)
+	default:
+	}
+}
@@ -185,7 +185,10 @@ func iterateTransactions(db ethdb.Database, from uint64, to uint64, reverse bool
 //
 // There is a passed channel, the whole procedure will be interrupted if any
 // signal received.
-func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool, report bool) {
+//
+// The optional indexed callback is invoked with the transaction hashes of every
+// block once its lookup entries have been flushed to disk.
+func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool, indexed func(uint64, []common.Hash), report bool) {
 	// short circuit for invalid range
 	if offset := db.BlockStore().AncientOffSet(); offset > from {
 		from = offset
@@ -204,8 +207,17 @@ func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan
 		// queue gap-evaluation will work correctly
 		lastNum     = to
 		queue       = prque.New[int64, *blockTxHashes](nil)
-		blocks, txs = 0, 0 // for stats reporting
+		flushed     []*blockTxHashes // deliveries pending the next batch flush
+		blocks, txs = 0, 0           // for stats reporting
 	)
+	notify := func() {
+		if indexed != nil {
+			for _, delivery := range flushed {
+				indexed(delivery.number, delivery.hashes)
+			}
+		}
+		flushed = flushed[:0]
+	}
 	for chanDelivery := range hashesCh {
 		// Push the delivery into the queue and process contiguous ranges.
 		// Since we iterate in reverse, so lower numbers have lower prio, and
@@ -224,6 +236,9 @@ func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan
 			delivery := queue.PopItem()
 			lastNum = delivery.number
 			WriteTxLookupEntries(batch, delivery.number, delivery.hashes)
+			if indexed != nil {
+				flushed = append(flushed, delivery)
+			}
 			blocks++
 			txs += len(delivery.hashes)
 			// If enough data was accumulated in memory or we're at the last block, dump to disk
@@ -234,6 +249,7 @@ func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan
 					return
 				}
 				batch.Reset()
+				notify()
 			}
 			// If we've spent too much time already, notify the user of what we're doing
 			if time.Since(logged) > 8*time.Second {
@@ -250,6 +266,8 @@ func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan
 		log.Crit("Failed writing batch to db", "error", err)
 		return
 	}
+	notify()
+
 	logger := log.Debug
 	if report {
 		logger = log.Info
@@ -272,12 +290,19 @@ func indexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan
 // There is a passed channel, the whole procedure will be interrupted if any
 // signal received.
 func IndexTransactions(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, report bool) {
-	indexTransactions(db, from, to, interrupt, nil, report)
+	indexTransactions(db, from, to, interrupt, nil, nil, report)
+}
+
+// IndexTransactionsWithCallback is like IndexTransactions, but additionally
+// invokes the indexed callback with the transaction hashes of every block once
+// its lookup entries have been flushed to disk along with the index tail.
+func IndexTransactionsWithCallback(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, indexed func(number uint64, hashes []common.Hash), report bool) {
+	indexTransactions(db, from, to, interrupt, nil, indexed, report)
 }
 
 // indexTransactionsForTesting is the internal debug version with an additional hook.
 func indexTransactionsForTesting(db ethdb.Database, from uint64, to uint64, interrupt chan struct{}, hook func(uint64) bool) {
-	indexTransactions(db, from, to, interrupt, hook, false)
+	indexTransactions(db, from, to, interrupt, hook, nil, false)
 }
 
 // unindexTransactions removes txlookup indices of the specified block range.
@@ -28,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/olekukonko/tablewriter"
 )
@@ -144,6 +145,23 @@ func (frdb *freezerdb) HasSeparateBlockStore() bool {
 	return frdb.blockStore != nil
 }
 
+// SubscribeFrozenEvent registers a subscription of FrozenEvent on the freezer of
+// the given database. Nil is returned if the database has no freezer moving the
+// blocks out of the key-value store.
+func SubscribeFrozenEvent(db ethdb.Database, ch chan<- FrozenEvent) event.Subscription {
+	frdb, ok := db.(*freezerdb)
+	if !ok {
+		return nil
+	}
+	freezer, ok := frdb.AncientStore.(interface {
+		SubscribeFrozenEvent(ch chan<- FrozenEvent) event.Subscription
+	})
+	if !ok {
+		return nil
+	}
+	return freezer.SubscribeFrozenEvent(ch)
+}
+
 // Freeze is a helper method used for external testing to trigger and block until
 // a freeze cycle completes, without having to sleep for a minute to trigger the
 // automatic background run.
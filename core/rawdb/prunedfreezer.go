@@ -12,6 +12,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/prometheus/tsdb/fileutil"
@@ -29,6 +30,8 @@ type prunedfreezer struct {
 	instanceLock fileutil.Releaser // File-system lock to prevent double opens
 	quit         chan struct{}
 	closeOnce    sync.Once
+
+	frozenFeed event.Feed // Feed of block ranges moved out of the key-value store
 }
 
 // newNoDataFreezer creates a chain freezer that deletes data enough ‘old’.
@@ -321,9 +324,19 @@ func (f *prunedfreezer) freeze() {
 		}
 		backoff = f.frozen-first >= freezerBatchLimit
 		gcKvStore(f.db, ancients, first, f.frozen, start)
+
+		if f.frozen > first {
+			f.frozenFeed.Send(FrozenEvent{From: first, To: f.frozen - 1})
+		}
 	}
 }
 
+// SubscribeFrozenEvent registers a subscription of FrozenEvent, posted after
+// each freeze cycle.
+func (f *prunedfreezer) SubscribeFrozenEvent(ch chan<- FrozenEvent) event.Subscription {
+	return f.frozenFeed.Subscribe(ch)
+}
+
 func (f *prunedfreezer) SetupFreezerEnv(env *ethdb.FreezerEnv) error {
 	return nil
 }
@@ -271,6 +271,23 @@ func (db *CachingDB) ContractCodeWithPrefix(address common.Address, codeHash com
 	return code
 }
 
+// ContractCodeSizeWithPrefix retrieves a particular contract's code size. If the
+// size is not cached, the code is read with the **new** db scheme and only its
+// size is retained, the code itself is not cached.
+func (db *CachingDB) ContractCodeSizeWithPrefix(address common.Address, codeHash common.Hash) int {
+	if cached, ok := db.codeSizeCache.Get(codeHash); ok {
+		return cached
+	}
+	if code, _ := db.codeCache.Get(codeHash); len(code) > 0 {
+		return len(code)
+	}
+	code := rawdb.ReadCodeWithPrefix(db.disk, codeHash)
+	if len(code) > 0 {
+		db.codeSizeCache.Add(codeHash, len(code))
+	}
+	return len(code)
+}
+
 // TrieDB retrieves any intermediate trie-node caching layer.
 func (db *CachingDB) TrieDB() *triedb.Database {
 	return db.triedb
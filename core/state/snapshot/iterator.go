@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
 
@@ -57,6 +58,13 @@ type AccountIterator interface {
 	Account() []byte
 }
 
+// Account is a decoded account yielded by an account iterator, along with the
+// hash of its address.
+type Account struct {
+	Hash    common.Hash
+	Account *types.StateAccount
+}
+
 // StorageIterator is an iterator to step over the specific storage in a snapshot,
 // which may or may not be composed of multiple layers.
 type StorageIterator interface {
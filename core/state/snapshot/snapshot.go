@@ -845,6 +845,21 @@ func (t *Tree) generating() (bool, error) {
 	return layer.genMarker != nil, nil
 }
 
+// Generating reports whether the disk layer is still being generated, along
+// with a copy of the generation marker, which is nil once generation is done.
+func (t *Tree) Generating() (bool, []byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	layer := t.disklayer()
+	if layer == nil {
+		return false, nil, errors.New("disk layer is missing")
+	}
+	layer.lock.RLock()
+	defer layer.lock.RUnlock()
+	return layer.genMarker != nil, common.CopyBytes(layer.genMarker), nil
+}
+
 // DiskRoot is an external helper function to return the disk layer root.
 func (t *Tree) DiskRoot() common.Hash {
 	t.lock.RLock()
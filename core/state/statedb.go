@@ -18,6 +18,7 @@
 package state
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"maps"
@@ -182,11 +183,24 @@ func NewWithSharedPool(root common.Hash, db Database) (*StateDB, error) {
 
 // New creates a new state from a given trie.
 func New(root common.Hash, db Database) (*StateDB, error) {
+	return NewWithContext(context.Background(), root, db)
+}
+
+// NewWithContext creates a new state from a given trie like New, but gives up if
+// the context is cancelled before or between opening the trie and the state
+// reader. A step already in progress is not interrupted.
+func NewWithContext(ctx context.Context, root common.Hash, db Database) (*StateDB, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	tr, err := db.OpenTrie(root)
 	if err != nil {
 		return nil, err
 	}
 	_, noTrie := tr.(*trie.EmptyTrie)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	reader, err := db.Reader(root)
 	if err != nil {
 		return nil, err
@@ -212,6 +226,58 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 	return sdb, nil
 }
 
+// Reset rebases the state onto the given root, dropping all the cached state
+// objects and pending changes, while retaining the already allocated internal
+// maps for reuse. The state must not be used concurrently during the reset.
+func (s *StateDB) Reset(root common.Hash) error {
+	tr, err := s.db.OpenTrie(root)
+	if err != nil {
+		return err
+	}
+	reader, err := s.db.Reader(root)
+	if err != nil {
+		return err
+	}
+	s.StopPrefetcher()
+
+	_, s.noTrie = tr.(*trie.EmptyTrie)
+	s.trie = tr
+	s.reader = reader
+	s.originalRoot = root
+	s.expectedRoot = common.Hash{}
+	s.fullProcessed = false
+
+	clear(s.stateObjects)
+	clear(s.stateObjectsDestruct)
+	clear(s.mutations)
+	clear(s.logs)
+	clear(s.preimages)
+
+	// The shared origin storage belongs to the previous root, detach it
+	s.storagePool = nil
+	s.writeOnSharedStorage = false
+
+	s.dbErr = nil
+	s.refund = 0
+	s.thash = common.Hash{}
+	s.txIndex = 0
+	s.logSize = 0
+	s.accessList = newAccessList()
+	s.transientStorage = newTransientStorage()
+	s.journal.reset()
+	s.witness = nil
+	if s.db.TrieDB().IsVerkle() {
+		s.accessEvents = NewAccessEvents(s.db.PointCache())
+	}
+	s.AccountReads, s.AccountHashes, s.AccountUpdates, s.AccountCommits = 0, 0, 0, 0
+	s.StorageReads, s.StorageUpdates, s.StorageCommits = 0, 0, 0
+	s.SnapshotCommits, s.TrieDBCommits = 0, 0
+	s.AccountLoaded, s.AccountUpdated, s.AccountDeleted, s.StorageLoaded = 0, 0, 0, 0
+	s.StorageUpdated.Store(0)
+	s.StorageDeleted.Store(0)
+	return nil
+}
+
 func (s *StateDB) EnableWriteOnSharedStorage() {
 	s.writeOnSharedStorage = true
 }
@@ -18,7 +18,9 @@ package state
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"maps"
 	"math"
@@ -45,6 +47,41 @@ import (
 	"github.com/holiman/uint256"
 )
 
+// cancellingDatabase cancels a context once the state trie is opened, like a
+// client disconnecting while the database is slow.
+type cancellingDatabase struct {
+	Database
+	cancel  context.CancelFunc
+	readers int
+}
+
+func (db *cancellingDatabase) OpenTrie(root common.Hash) (Trie, error) {
+	db.cancel()
+	return db.Database.OpenTrie(root)
+}
+
+func (db *cancellingDatabase) Reader(root common.Hash) (Reader, error) {
+	db.readers++
+	return db.Database.Reader(root)
+}
+
+// Tests that opening a state is aborted between its steps once the context is
+// cancelled.
+func TestNewWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := &cancellingDatabase{Database: NewDatabaseForTesting(), cancel: cancel}
+
+	if _, err := NewWithContext(ctx, types.EmptyRootHash, db); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if db.readers != 0 {
+		t.Fatalf("state reader opened after cancellation: %d", db.readers)
+	}
+	if _, err := NewWithContext(context.Background(), types.EmptyRootHash, db); err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+}
+
 // Tests that updating a state trie does not leak any database writes prior to
 // actually committing the state.
 func TestUpdateLeaks(t *testing.T) {
@@ -1368,3 +1405,45 @@ func TestStorageDirtiness(t *testing.T) {
 	state.RevertToSnapshot(snap)
 	checkDirty(common.Hash{0x1}, common.Hash{0x1}, true)
 }
+
+// TestResetState tests that a state rebased onto another root reflects that
+// root and drops all the previously cached or pending changes.
+func TestResetState(t *testing.T) {
+	var (
+		db    = NewDatabaseForTesting()
+		addr  = common.Address{0x01}
+		state = func(balance uint64) common.Hash {
+			s, _ := New(types.EmptyRootHash, db)
+			s.SetBalance(addr, uint256.NewInt(balance), tracing.BalanceChangeUnspecified)
+			root, _, err := s.Commit(0, false, false)
+			if err != nil {
+				t.Fatalf("failed to commit state: %v", err)
+			}
+			return root
+		}
+		rootA = state(1)
+		rootB = state(2)
+	)
+	s, _ := New(rootA, db)
+	if have := s.GetBalance(addr).Uint64(); have != 1 {
+		t.Fatalf("balance mismatch: have %d, want %d", have, 1)
+	}
+	s.SetNonce(addr, 5, tracing.NonceChangeUnspecified)
+	s.AddRefund(100)
+
+	if err := s.Reset(rootB); err != nil {
+		t.Fatalf("failed to reset state: %v", err)
+	}
+	if have := s.GetBalance(addr).Uint64(); have != 2 {
+		t.Fatalf("balance mismatch after reset: have %d, want %d", have, 2)
+	}
+	if have := s.GetNonce(addr); have != 0 {
+		t.Fatalf("pending nonce change retained: have %d, want %d", have, 0)
+	}
+	if have := s.GetRefund(); have != 0 {
+		t.Fatalf("refund counter retained: have %d, want %d", have, 0)
+	}
+	if root := s.IntermediateRoot(false); root != rootB {
+		t.Fatalf("root mismatch: have %x, want %x", root, rootB)
+	}
+}
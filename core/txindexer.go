@@ -20,11 +20,18 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 )
 
+// txIndexProgressInterval is the minimum number of newly indexed blocks before
+// a progress update is emitted to subscribers.
+const txIndexProgressInterval = 1024
+
 // TxIndexProgress is the struct describing the progress for transaction indexing.
 type TxIndexProgress struct {
 	Indexed   uint64 // number of blocks whose transactions are indexed
@@ -49,6 +56,11 @@ type txIndexer struct {
 	progress chan chan TxIndexProgress
 	term     chan chan struct{}
 	closed   chan struct{}
+
+	progressFeed event.Feed              // Feed of throttled indexing progress updates
+	indexedFeed  event.Feed              // Feed of blocks whose transactions became retrievable
+	indexedScope event.SubscriptionScope // Subscriptions of indexedFeed, to skip the announcements without any
+	announced    *types.Header           // Latest head announced via indexedFeed, only accessed by the running task
 }
 
 // newTxIndexer initializes the transaction indexer.
@@ -83,6 +95,8 @@ func (indexer *txIndexer) run(tail *uint64, head uint64, stop chan struct{}, don
 	if head == 0 {
 		return
 	}
+	// Announce the new canonical blocks once the indexes are adjusted
+	defer indexer.announce(head, stop)
 	// The tail flag is not existent, it means the node is just initialized
 	// and all blocks in the chain (part of them may from ancient store) are
 	// not indexed yet, index the chain according to the configured limit.
@@ -91,7 +105,7 @@ func (indexer *txIndexer) run(tail *uint64, head uint64, stop chan struct{}, don
 		if indexer.limit != 0 && head >= indexer.limit {
 			from = head - indexer.limit + 1
 		}
-		rawdb.IndexTransactions(indexer.db, from, head+1, stop, true)
+		rawdb.IndexTransactionsWithCallback(indexer.db, from, head+1, stop, indexer.indexed, true)
 		return
 	}
 	// The tail flag is existent (which means indexes in [tail, head] should be
@@ -105,7 +119,7 @@ func (indexer *txIndexer) run(tail *uint64, head uint64, stop chan struct{}, don
 			if end > head+1 {
 				end = head + 1
 			}
-			rawdb.IndexTransactions(indexer.db, 0, end, stop, true)
+			rawdb.IndexTransactionsWithCallback(indexer.db, 0, end, stop, indexer.indexed, true)
 		}
 		return
 	}
@@ -113,13 +127,76 @@ func (indexer *txIndexer) run(tail *uint64, head uint64, stop chan struct{}, don
 	// limit and the latest chain head.
 	if head-indexer.limit+1 < *tail {
 		// Reindex a part of missing indices and rewind index tail to HEAD-limit
-		rawdb.IndexTransactions(indexer.db, head-indexer.limit+1, *tail, stop, true)
+		rawdb.IndexTransactionsWithCallback(indexer.db, head-indexer.limit+1, *tail, stop, indexer.indexed, true)
 	} else {
 		// Unindex a part of stale indices and forward index tail to HEAD-limit
 		rawdb.UnindexTransactions(indexer.db, *tail, head-indexer.limit+1, stop, false)
 	}
 }
 
+// subscribeIndexed registers a subscription of the indexed transactions.
+func (indexer *txIndexer) subscribeIndexed(ch chan<- TxIndexedEvent) event.Subscription {
+	return indexer.indexedScope.Track(indexer.indexedFeed.Subscribe(ch))
+}
+
+// indexed announces the transactions of a block whose lookup entries have been
+// flushed to disk. Blocks without transactions are not announced.
+//
+// The announcement is sent from the indexing routine, which is blocked until all
+// subscribers received it.
+func (indexer *txIndexer) indexed(number uint64, hashes []common.Hash) {
+	if len(hashes) > 0 && indexer.indexedScope.Count() > 0 {
+		indexer.indexedFeed.Send(TxIndexedEvent{Number: number, Hashes: hashes})
+	}
+}
+
+// announce announces the transactions of the canonical blocks above the last
+// announced head up to the given one. Their lookup entries are written by the
+// chain itself when the blocks become canonical, the indexer only backfills the
+// older ones. Blocks reorged in since the last announcement are covered too.
+func (indexer *txIndexer) announce(head uint64, stop chan struct{}) {
+	header := rawdb.ReadHeader(indexer.db, rawdb.ReadCanonicalHash(indexer.db, head), head)
+	if header == nil {
+		return
+	}
+	last := indexer.announced
+	indexer.announced = header
+
+	// Nothing was announced before, the blocks up to the head are either indexed
+	// by the initial backfill or predate the subscriptions. Without subscribers,
+	// only the announced head is tracked to avoid reading the bodies.
+	if last == nil || indexer.indexedScope.Count() == 0 {
+		return
+	}
+	// Rewind to the last announced block which is still canonical
+	for last != nil && rawdb.ReadCanonicalHash(indexer.db, last.Number.Uint64()) != last.Hash() {
+		last = rawdb.ReadHeader(indexer.db, last.ParentHash, last.Number.Uint64()-1)
+	}
+	if last == nil {
+		return
+	}
+	from := last.Number.Uint64() + 1
+	if indexer.limit != 0 && head >= indexer.limit && from < head-indexer.limit+1 {
+		from = head - indexer.limit + 1
+	}
+	for number := from; number <= head; number++ {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		body := rawdb.ReadBody(indexer.db, rawdb.ReadCanonicalHash(indexer.db, number), number)
+		if body == nil {
+			return
+		}
+		hashes := make([]common.Hash, len(body.Transactions))
+		for i, tx := range body.Transactions {
+			hashes[i] = tx.Hash()
+		}
+		indexer.indexed(number, hashes)
+	}
+}
+
 // loop is the scheduler of the indexer, assigning indexing/unindexing tasks depending
 // on the received chain event.
 func (indexer *txIndexer) loop(chain *BlockChain) {
@@ -131,6 +208,7 @@ func (indexer *txIndexer) loop(chain *BlockChain) {
 		done     chan struct{}                       // Non-nil if background routine is active.
 		lastHead uint64                              // The latest announced chain head (whose tx indexes are assumed created)
 		lastTail = rawdb.ReadTxIndexTail(indexer.db) // The oldest indexed block, nil means nothing indexed
+		reported *TxIndexProgress                    // The last progress announced to subscribers
 
 		headCh = make(chan ChainHeadEvent)
 		sub    = chain.SubscribeChainHeadEvent(headCh)
@@ -158,6 +236,14 @@ func (indexer *txIndexer) loop(chain *BlockChain) {
 			stop = nil
 			done = nil
 			lastTail = rawdb.ReadTxIndexTail(indexer.db)
+
+			// Announce the progress if enough blocks were indexed since the
+			// last update, or the indexing state flipped.
+			progress := indexer.report(lastHead, lastTail)
+			if reported == nil || progress.Done() != reported.Done() || diffBlocks(progress.Indexed, reported.Indexed) >= txIndexProgressInterval {
+				indexer.progressFeed.Send(progress)
+				reported = &progress
+			}
 		case ch := <-indexer.progress:
 			ch <- indexer.report(lastHead, lastTail)
 		case ch := <-indexer.term:
@@ -174,6 +260,14 @@ func (indexer *txIndexer) loop(chain *BlockChain) {
 	}
 }
 
+// diffBlocks returns the absolute difference between two block counts.
+func diffBlocks(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
 // report returns the tx indexing progress.
 func (indexer *txIndexer) report(head uint64, tail *uint64) TxIndexProgress {
 	total := indexer.limit
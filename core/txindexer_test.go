@@ -238,3 +238,80 @@ func TestTxIndexer(t *testing.T) {
 		db.Close()
 	}
 }
+
+// TestTxIndexerAnnounce tests that the transactions of backfilled blocks are
+// announced once their indexes are written.
+func TestTxIndexerAnnounce(t *testing.T) {
+	var (
+		testBankKey, _  = crypto.GenerateKey()
+		testBankAddress = crypto.PubkeyToAddress(testBankKey.PublicKey)
+		testBankFunds   = big.NewInt(1000000000000000000)
+
+		gspec = &Genesis{
+			Config:  params.TestChainConfig,
+			Alloc:   types.GenesisAlloc{testBankAddress: {Balance: testBankFunds}},
+			BaseFee: big.NewInt(params.InitialBaseFee),
+		}
+		engine    = ethash.NewFaker()
+		nonce     = uint64(0)
+		chainHead = uint64(128)
+	)
+	_, blocks, receipts := GenerateChainWithGenesis(gspec, engine, int(chainHead), func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, common.HexToAddress("0xdeadbeef"), big.NewInt(1000), params.TxGas, big.NewInt(10*params.InitialBaseFee), nil), types.HomesteadSigner{}, testBankKey)
+		gen.AddTx(tx)
+		nonce += 1
+	})
+	db, _ := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), "", "", false, false, false, false, false)
+	defer db.Close()
+	rawdb.WriteAncientBlocks(db, append([]*types.Block{gspec.ToBlock()}, blocks...), append([]types.Receipts{{}}, receipts...), big.NewInt(0))
+
+	indexer := &txIndexer{
+		limit:    32,
+		db:       db,
+		progress: make(chan chan TxIndexProgress),
+	}
+	// Index the latest blocks without any subscribers
+	indexer.run(nil, chainHead, make(chan struct{}), make(chan struct{}))
+
+	events := make(chan TxIndexedEvent, chainHead)
+	sub := indexer.subscribeIndexed(events)
+	defer sub.Unsubscribe()
+
+	// verify checks that exactly the blocks in [from, to] were announced, each
+	// with retrievable transactions.
+	verify := func(from, to uint64) {
+		announced := make(map[uint64]bool)
+		for len(events) > 0 {
+			ev := <-events
+			if announced[ev.Number] {
+				t.Fatalf("block #%d announced twice", ev.Number)
+			}
+			announced[ev.Number] = true
+
+			block := blocks[ev.Number-1]
+			if len(ev.Hashes) != 1 || ev.Hashes[0] != block.Transactions()[0].Hash() {
+				t.Fatalf("block #%d: announced transactions mismatch", ev.Number)
+			}
+			if rawdb.ReadTxLookupEntry(db, ev.Hashes[0]) == nil {
+				t.Fatalf("block #%d: announced transaction not indexed", ev.Number)
+			}
+		}
+		if len(announced) != int(to-from+1) {
+			t.Fatalf("announced block count mismatch: have %d, want %d", len(announced), to-from+1)
+		}
+		for number := from; number <= to; number++ {
+			if !announced[number] {
+				t.Fatalf("block #%d not announced", number)
+			}
+		}
+	}
+	// Extend the indexes, only the backfilled blocks are announced
+	indexer.limit = 64
+	indexer.run(rawdb.ReadTxIndexTail(db), chainHead, make(chan struct{}), make(chan struct{}))
+	verify(chainHead-63, chainHead-32)
+
+	// Extend the indexes to the entire chain, the genesis has no transactions
+	indexer.limit = 0
+	indexer.run(rawdb.ReadTxIndexTail(db), chainHead, make(chan struct{}), make(chan struct{}))
+	verify(1, chainHead-64)
+}
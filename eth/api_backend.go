@@ -165,24 +165,11 @@ func (b *EthAPIBackend) GetBody(ctx context.Context, hash common.Hash, number rp
 }
 
 func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
-	if blockNr, ok := blockNrOrHash.Number(); ok {
+	// Pending block is only known by the miner
+	if blockNr, ok := blockNrOrHash.Number(); ok && blockNr == rpc.PendingBlockNumber {
 		return b.BlockByNumber(ctx, blockNr)
 	}
-	if hash, ok := blockNrOrHash.Hash(); ok {
-		header := b.eth.blockchain.GetHeaderByHash(hash)
-		if header == nil {
-			return nil, errors.New("header for hash not found")
-		}
-		if blockNrOrHash.RequireCanonical && b.eth.blockchain.GetCanonicalHash(header.Number.Uint64()) != hash {
-			return nil, errors.New("hash is not currently canonical")
-		}
-		block := b.eth.blockchain.GetBlock(hash, header.Number.Uint64())
-		if block == nil {
-			return nil, errors.New("header found, but block body is missing")
-		}
-		return block, nil
-	}
-	return nil, errors.New("invalid arguments; neither block nor hash specified")
+	return b.eth.blockchain.GetBlockByNumberOrHash(blockNrOrHash)
 }
 
 func (b *EthAPIBackend) Pending() (*types.Block, types.Receipts, *state.StateDB) {